@@ -1,10 +1,11 @@
 package wxhelper
 
 import (
-	"context"
 	"errors"
+	"github.com/eatmoreapple/wxhelper/apiclient"
 	"io"
 	"strconv"
+	"time"
 )
 
 type Account struct {
@@ -26,7 +27,7 @@ type Account struct {
 }
 
 func (a *Account) Friends() (Friends, error) {
-	members, err := a.bot.client.GetContactList(context.Background())
+	members, err := a.bot.contacts.Members(a.bot.Context())
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +39,7 @@ func (a *Account) Friends() (Friends, error) {
 }
 
 func (a *Account) Groups() (Groups, error) {
-	members, err := a.bot.client.GetContactList(context.Background())
+	members, err := a.bot.contacts.Members(a.bot.Context())
 	if err != nil {
 		return nil, err
 	}
@@ -54,15 +55,65 @@ func (a *Account) FileHelper() *User {
 }
 
 func (a *Account) sendText(wxID string, content string) error {
-	return a.bot.client.SendText(a.bot.Context(), wxID, content)
+	if err := a.bot.waitSend(wxID); err != nil {
+		return err
+	}
+	return a.postText(wxID, content)
+}
+
+// postText sends the text without waiting for the RateLimiter, the caller has waited.
+func (a *Account) postText(wxID string, content string) error {
+	if err := a.bot.client.SendText(a.bot.Context(), wxID, content); err != nil {
+		return err
+	}
+	a.storeSent(&Message{ToUser: wxID, Type: 1, Content: content})
+	return nil
 }
 
 func (a *Account) sendImage(account string, img io.Reader) error {
-	return a.bot.client.SendImage(a.bot.Context(), account, img)
+	if err := a.bot.waitSend(account); err != nil {
+		return err
+	}
+	if err := a.bot.client.SendImage(a.bot.Context(), account, img); err != nil {
+		return err
+	}
+	a.storeSent(&Message{ToUser: account, Type: 3})
+	return nil
 }
 
 func (a *Account) sendFile(account string, file io.Reader) error {
-	return a.bot.client.SendFile(a.bot.Context(), account, file)
+	if err := a.bot.waitSend(account); err != nil {
+		return err
+	}
+	if err := a.bot.client.SendFile(a.bot.Context(), account, file); err != nil {
+		return err
+	}
+	a.storeSent(&Message{ToUser: account, Type: 49})
+	return nil
+}
+
+func (a *Account) sendAtText(groupID string, content string, memberIDs []string) error {
+	if err := a.bot.waitSend(groupID); err != nil {
+		return err
+	}
+	err := a.bot.client.SendAtText(a.bot.Context(), apiclient.SendAtTextOption{
+		GroupID: groupID,
+		AtList:  memberIDs,
+		Content: content,
+	})
+	if err != nil {
+		return err
+	}
+	a.storeSent(&Message{ToUser: groupID, Type: 1, Content: content})
+	return nil
+}
+
+// storeSent records the message sent by the account into the bot's MessageStore.
+func (a *Account) storeSent(msg *Message) {
+	msg.FromUser = a.Wxid
+	msg.CreateTime = int(time.Now().Unix())
+	msg.account = a
+	a.bot.storeMessage(msg)
 }
 
 func (a *Account) SendTextToFriend(friend *Friend, content string) error {
@@ -109,8 +160,28 @@ func (a *Account) AddMemberIntoChatRoom(group *Group, users ...*Friend) error {
 	}
 }
 
+// DelMemberFromChatRoom 把成员移出群聊，需要是群主或者管理员
+func (a *Account) DelMemberFromChatRoom(group *Group, memberIDs ...string) error {
+	if len(memberIDs) == 0 {
+		return errors.New("no member to remove")
+	}
+	return a.bot.client.DelMemberFromChatRoom(a.bot.Context(), group.User.Wxid, memberIDs)
+}
+
+// ModifyNickname 修改自己在群里的昵称
+func (a *Account) ModifyNickname(group *Group, nickname string) error {
+	return a.bot.client.ModifyNickname(a.bot.Context(), group.User.Wxid, a.Wxid, nickname)
+}
+
 func (a *Account) ForwardMessage(msg *Message, user *User) error {
-	return a.bot.client.ForwardMsg(a.bot.Context(), user.Wxid, strconv.FormatInt(msg.MsgId, 10))
+	if err := a.bot.waitSend(user.Wxid); err != nil {
+		return err
+	}
+	if err := a.bot.client.ForwardMsg(a.bot.Context(), user.Wxid, strconv.FormatInt(msg.MsgId, 10)); err != nil {
+		return err
+	}
+	a.storeSent(&Message{ToUser: user.Wxid, Type: msg.Type, Content: msg.Text()})
+	return nil
 }
 
 func (a *Account) QuitChatRoom(group *Group) error {
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"github.com/eatmoreapple/wxhelper/apiserver"
 	. "github.com/eatmoreapple/wxhelper/internal/models"
 	"github.com/google/uuid"
@@ -12,8 +13,15 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// namedReader is a reader with a file name, such as *os.File.
+type namedReader interface {
+	io.Reader
+	Name() string
+}
+
 type Client struct {
 	transport *Transport
 }
@@ -24,6 +32,9 @@ func (c *Client) GetUserInfo(ctx context.Context) (*Account, error) {
 		return nil, err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return nil, err
+	}
 	var r Result[*Account]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return nil, err
@@ -40,6 +51,9 @@ func (c *Client) CheckLogin(ctx context.Context) (bool, error) {
 		return false, err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return false, err
+	}
 	var r Result[bool]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return false, err
@@ -56,6 +70,9 @@ func (c *Client) GetContactList(ctx context.Context) (Members, error) {
 		return nil, err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return nil, err
+	}
 	var r Result[Members]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return nil, err
@@ -72,6 +89,9 @@ func (c *Client) SendText(ctx context.Context, to, content string) error {
 		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return err
+	}
 	var r Result[any]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return err
@@ -81,7 +101,7 @@ func (c *Client) SendText(ctx context.Context, to, content string) error {
 
 func (c *Client) SendImage(ctx context.Context, to string, img io.Reader) error {
 	var filename string
-	if f, ok := img.(*os.File); ok {
+	if f, ok := img.(namedReader); ok {
 		// a correct image name is required
 		filename = filepath.Base(f.Name())
 	} else {
@@ -96,6 +116,9 @@ func (c *Client) SendImage(ctx context.Context, to string, img io.Reader) error
 		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return err
+	}
 	var r Result[any]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return err
@@ -105,7 +128,7 @@ func (c *Client) SendImage(ctx context.Context, to string, img io.Reader) error
 
 func (c *Client) SendFile(ctx context.Context, to string, file io.Reader) error {
 	var filename string
-	if f, ok := file.(*os.File); ok {
+	if f, ok := file.(namedReader); ok {
 		filename = filepath.Base(f.Name())
 	} else {
 		filename = uuid.New().String()
@@ -119,6 +142,9 @@ func (c *Client) SendFile(ctx context.Context, to string, file io.Reader) error
 		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return err
+	}
 	var r Result[any]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return err
@@ -132,10 +158,16 @@ func (c *Client) SyncMessage(ctx context.Context) ([]*Message, error) {
 		return nil, err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return nil, err
+	}
 	var r Result[[]*Message]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return nil, err
 	}
+	if err = r.Err(); err != nil {
+		return nil, err
+	}
 	return r.Data, nil
 }
 
@@ -145,6 +177,9 @@ func (c *Client) GetChatRoomDetail(ctx context.Context, chatRoomId string) (*Cha
 		return nil, err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return nil, err
+	}
 	var r Result[ChatRoomInfo]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return nil, err
@@ -161,6 +196,9 @@ func (c *Client) GetMemberFromChatRoom(ctx context.Context, chatRoomId string) (
 		return nil, err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return nil, err
+	}
 	var r Result[[]*Profile]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return nil, err
@@ -177,6 +215,9 @@ func (c *Client) SendAtText(ctx context.Context, opt SendAtTextOption) error {
 		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return err
+	}
 	var r Result[any]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return err
@@ -190,6 +231,41 @@ func (c *Client) AddMemberIntoChatRoom(ctx context.Context, chatRoomID string, m
 		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return err
+	}
+	var r Result[any]
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	return r.Err()
+}
+
+func (c *Client) DelMemberFromChatRoom(ctx context.Context, chatRoomID string, memberIDs []string) error {
+	resp, err := c.transport.DelMemberFromChatRoom(ctx, chatRoomID, memberIDs)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return err
+	}
+	var r Result[any]
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	return r.Err()
+}
+
+func (c *Client) ModifyNickname(ctx context.Context, chatRoomID, wxID, nickname string) error {
+	resp, err := c.transport.ModifyNickname(ctx, chatRoomID, wxID, nickname)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return err
+	}
 	var r Result[any]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return err
@@ -203,6 +279,9 @@ func (c *Client) InviteMemberToChatRoom(ctx context.Context, chatRoomID string,
 		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return err
+	}
 	var r Result[any]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return err
@@ -216,6 +295,9 @@ func (c *Client) ForwardMsg(ctx context.Context, wxID, msgID string) error {
 		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return err
+	}
 	var r Result[any]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return err
@@ -289,6 +371,59 @@ func (c *Client) QuitChatRoom(ctx context.Context, chatRoomId string) error {
 		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if err = checkStatus(resp); err != nil {
+		return err
+	}
+	var r Result[any]
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	return r.Err()
+}
+
+// DownloadMedia writes the media of the message to w.
+func (c *Client) DownloadMedia(ctx context.Context, req apiserver.DownloadMediaRequest, w io.Writer) error {
+	resp, err := c.transport.DownloadMedia(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUnsupported
+	}
+	if err = checkStatus(resp); err != nil {
+		return err
+	}
+	// 失败时返回的是 json
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var r Result[any]
+		if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+			return err
+		}
+		if err = r.Err(); err != nil {
+			return err
+		}
+		return errors.New("unexpected media response")
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// SendQuote sends the reply quoting the message.
+// It returns ErrUnsupported if the apiserver or the inject server does not support it.
+func (c *Client) SendQuote(ctx context.Context, req apiserver.SendQuoteRequest) error {
+	resp, err := c.transport.SendQuote(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	// 旧版本的 apiserver 没有这个接口
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUnsupported
+	}
+	if err = checkStatus(resp); err != nil {
+		return err
+	}
 	var r Result[any]
 	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
 		return err
@@ -1,11 +1,31 @@
 package apiclient
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
 
 var ErrAuth = errors.New("auth error")
 
+// ErrUnsupported is returned when the apiserver or the inject server does not support the api.
+var ErrUnsupported = errors.New("unsupported")
+
+var (
+	// ErrNotGroupAdmin is returned when the account is not the owner or an admin of the group.
+	ErrNotGroupAdmin = errors.New("not the owner or an admin of the group")
+	// ErrNotGroupMember is returned when the user is not a member of the group.
+	ErrNotGroupMember = errors.New("not a member of the group")
+)
+
 const (
-	authErrCode = 2
+	authErrCode           = 2
+	unsupportedErrCode    = 3
+	notGroupAdminErrCode  = 4
+	notGroupMemberErrCode = 5
 )
 
 type Result[T any] struct {
@@ -25,7 +45,47 @@ func (r Result[T]) Err() error {
 	switch r.Code {
 	case authErrCode:
 		return ErrAuth
+	case unsupportedErrCode:
+		return ErrUnsupported
+	case notGroupAdminErrCode:
+		return fmt.Errorf("%w: %s", ErrNotGroupAdmin, r.Msg)
+	case notGroupMemberErrCode:
+		return fmt.Errorf("%w: %s", ErrNotGroupMember, r.Msg)
 	default:
-		return errors.New(r.Msg)
+		return &ResultError{Code: r.Code, Msg: r.Msg}
+	}
+}
+
+// ResultError 是 apiserver 返回的失败结果，通常是注入服务器调用失败
+type ResultError struct {
+	Code int
+	Msg  string
+}
+
+func (e *ResultError) Error() string { return e.Msg }
+
+// StatusError 是 apiserver 或者中间的网关返回的非 2xx 状态码
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string { return "unexpected http status " + e.Status }
+
+// checkStatus returns an error if the response is not successful.
+// The apiserver returns the Result of auth errors with 401, so a failed Result in the body
+// is returned as its error, other bodies, like the JSON error page of a gateway, are a StatusError.
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	var r struct {
+		Code *int   `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") &&
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&r) == nil && r.Code != nil && *r.Code != 0 {
+		return Result[any]{Code: *r.Code, Msg: r.Msg}.Err()
 	}
+	return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 }
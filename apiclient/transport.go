@@ -222,6 +222,49 @@ func (c *Transport) AddMemberIntoChatRoom(ctx context.Context, chatRoomID string
 	return c.httpClient.Do(req)
 }
 
+func (c *Transport) DelMemberFromChatRoom(ctx context.Context, chatRoomID string, memberIDs []string) (*http.Response, error) {
+	url, err := urlpkg.Parse(c.baseURL + apiserver.DelMemberFromChatRoom)
+	if err != nil {
+		return nil, err
+	}
+	var payload = apiserver.DelMemberFromChatRoomRequest{
+		ChatRoomID: chatRoomID,
+		MemberIds:  memberIDs,
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url.String(), bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	return c.httpClient.Do(req)
+}
+
+func (c *Transport) ModifyNickname(ctx context.Context, chatRoomID, wxID, nickname string) (*http.Response, error) {
+	url, err := urlpkg.Parse(c.baseURL + apiserver.ModifyNickname)
+	if err != nil {
+		return nil, err
+	}
+	var payload = apiserver.ModifyNicknameRequest{
+		ChatRoomID: chatRoomID,
+		WxID:       wxID,
+		Nickname:   nickname,
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url.String(), bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	return c.httpClient.Do(req)
+}
+
 func (c *Transport) InviteMemberToChatRoom(ctx context.Context, chatRoomID string, memberIDs []string) (*http.Response, error) {
 	url, err := urlpkg.Parse(c.baseURL + apiserver.InviteMemberToChatRoom)
 	if err != nil {
@@ -322,3 +365,39 @@ func (c *Transport) QuitChatRoom(ctx context.Context, chatRoomId string) (*http.
 	req.Header.Add("Content-Type", "application/json")
 	return c.httpClient.Do(req)
 }
+
+// DownloadMedia 下载语音、视频、文件和表情
+func (c *Transport) DownloadMedia(ctx context.Context, payload apiserver.DownloadMediaRequest) (*http.Response, error) {
+	url, err := urlpkg.Parse(c.baseURL + apiserver.DownloadMedia)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url.String(), bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	return c.httpClient.Do(req)
+}
+
+// SendQuote 引用消息回复
+func (c *Transport) SendQuote(ctx context.Context, payload apiserver.SendQuoteRequest) (*http.Response, error) {
+	url, err := urlpkg.Parse(c.baseURL + apiserver.SendQuote)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url.String(), bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	return c.httpClient.Do(req)
+}
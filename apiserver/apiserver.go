@@ -9,10 +9,12 @@ import (
 	"github.com/eatmoreapple/wxhelper/apiserver/internal/msgbuffer"
 	. "github.com/eatmoreapple/wxhelper/internal/models"
 	"github.com/eatmoreapple/wxhelper/internal/wxclient"
+	"github.com/eatmoreapple/wxhelper/pkg/dedup"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"runtime"
@@ -40,6 +42,12 @@ type APIServer struct {
 	checker           Checker
 	OnContext         func(context.Context) context.Context
 	Context           context.Context
+	// MessageListenerAddr 是接收注入服务器消息回调的 TCP 地址，默认为 :$MSG_LISTENER_PORT
+	MessageListenerAddr string
+	// MediaDir 是微信 CurrentDataPath 挂载到本地的目录，用于读取下载的语音、视频和文件，默认为 $WECHAT_DATA_DIR
+	MediaDir string
+	// Deduplicator 在消息放入队列之前过滤重复推送的消息，为 nil 时不去重，New 不会设置，Default 会设置
+	Deduplicator *dedup.Deduplicator
 }
 
 func (a *APIServer) IsLogin() bool {
@@ -135,6 +143,10 @@ func (a *APIServer) SyncMessage(ctx context.Context, _ ginx.Empty) (*Result[[]*M
 	if errors.Is(err, msgbuffer.ErrNoMessage) {
 		return OK(messages), nil
 	}
+	// 等待期间退出登录，告诉客户端登录已经失效
+	if errors.Is(context.Cause(ctx), ErrLogout) {
+		return &Result[[]*Message]{Code: resultCodeAuthErr, Msg: ErrLogout.Error()}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -163,6 +175,10 @@ func (a *APIServer) GetMemberFromChatRoom(ctx context.Context, req GetMemberFrom
 	if err != nil {
 		return nil, err
 	}
+	// 注入服务器异常时返回空的成员列表，不能当作一个 wxid 为空的成员
+	if members.Members == "" {
+		return OK([]*Profile{}), nil
+	}
 	memberIds := strings.Split(members.Members, "^G")
 
 	ctx, cancel := context.WithCancelCause(ctx)
@@ -195,9 +211,23 @@ func (a *APIServer) GetMemberFromChatRoom(ctx context.Context, req GetMemberFrom
 	if err = eg.Wait(); err != nil {
 		return nil, err
 	}
+	for i, displayName := range displayNames(members.MemberNickname, len(result)) {
+		result[i].DisplayName = displayName
+	}
 	return OK(result), nil
 }
 
+// displayNames splits the display names of the n members.
+// 群昵称和成员的顺序一致，没有设置群昵称的成员是空字符串，末尾缺少的按照空字符串处理
+func displayNames(memberNickname string, n int) []string {
+	names := make([]string, n)
+	if memberNickname == "" {
+		return names
+	}
+	copy(names, strings.Split(memberNickname, "^G"))
+	return names
+}
+
 type SendAtTextRequest struct {
 	GroupID string   `json:"groupId"`
 	AtList  []string `json:"atList"`
@@ -241,6 +271,54 @@ func (a *APIServer) InviteMemberToChatRoom(ctx context.Context, req InviteMember
 	return OK[any](nil), nil
 }
 
+type DelMemberFromChatRoomRequest struct {
+	ChatRoomID string   `json:"chatRoomId"`
+	MemberIds  []string `json:"memberIds"`
+}
+
+func (a *APIServer) DelMemberFromChatRoom(ctx context.Context, req DelMemberFromChatRoomRequest) (*Result[any], error) {
+	members, err := a.client.GetMemberFromChatRoom(ctx, req.ChatRoomID)
+	if err != nil {
+		return nil, err
+	}
+	memberIDs := make(map[string]bool)
+	if members.Members != "" {
+		for _, id := range strings.Split(members.Members, "^G") {
+			memberIDs[id] = true
+		}
+	}
+	for _, id := range req.MemberIds {
+		if !memberIDs[id] {
+			return &Result[any]{Code: resultCodeNotGroupMember, Msg: id}, nil
+		}
+	}
+	return chatRoomResult(a.client.DelMemberFromChatRoom(ctx, req.ChatRoomID, req.MemberIds))
+}
+
+// chatRoomResult returns the Result of the chat room operation, the known errors have their own codes.
+func chatRoomResult(err error) (*Result[any], error) {
+	switch {
+	case err == nil:
+		return OK[any](nil), nil
+	case errors.Is(err, wxclient.ErrNotChatRoomAdmin):
+		return &Result[any]{Code: resultCodeNotGroupAdmin, Msg: err.Error()}, nil
+	case errors.Is(err, wxclient.ErrNotChatRoomMember):
+		return &Result[any]{Code: resultCodeNotGroupMember, Msg: err.Error()}, nil
+	default:
+		return nil, err
+	}
+}
+
+type ModifyNicknameRequest struct {
+	ChatRoomID string `json:"chatRoomId"`
+	WxID       string `json:"wxid"`
+	Nickname   string `json:"nickname"`
+}
+
+func (a *APIServer) ModifyNickname(ctx context.Context, req ModifyNicknameRequest) (*Result[any], error) {
+	return chatRoomResult(a.client.ModifyNickname(ctx, req.ChatRoomID, req.WxID, req.Nickname))
+}
+
 type ForwardMsgRequest struct {
 	WxID  string `json:"wxid"`
 	MsgID string `json:"msgId"`
@@ -324,40 +402,87 @@ func (a *APIServer) QuitChatRoom(ctx context.Context, req QuitChatRoomRequest) (
 }
 
 func (a *APIServer) startListen() error {
-	port := env.Name("MSG_LISTENER_PORT").IntOrElse(9999)
+	addr := a.MessageListenerAddr
+	if addr == "" {
+		addr = ":" + strconv.Itoa(env.Name("MSG_LISTENER_PORT").IntOrElse(9999))
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
 	{
-		msgListener := &TCPMessageListener{Addr: ":" + strconv.Itoa(port)}
+		msgListener := &TCPMessageListener{Addr: addr}
 		// 定义消息处理行为，将获取到的消息塞进队列中
 		var handler MessageHandlerFunc = func(message *Message) {
+			if a.isDuplicate(message) {
+				return
+			}
 			_ = a.msgBuffer.Put(context.TODO(), message)
 		}
 		// 避免阻塞
 		go func() {
 			var stopReason error
 			// 当 msgListener 停止之后 APIServer 也随之停止
-			defer a.stop(stopReason)
-			stopReason = msgListener.ListenAndServe(handler)
+			defer func() { a.stop(stopReason) }()
+			stopReason = msgListener.Serve(listener, handler)
 			log.Ctx(a.ctx).Error().Err(stopReason).Msg("listen and serve message failed")
 		}()
+		// APIServer 停止之后关闭 listener
+		context.AfterFunc(a.ctx, func() { _ = listener.Close() })
 	}
+	tcpAddr := listener.Addr().(*net.TCPAddr)
 	// 尝试去注册消息回调
-	// 已经在一个容器内了，直接用localhost
-	return a.client.HookSyncMsg(a.ctx, "localhost", port)
+	// 已经在一个容器内了，没有指定地址时直接用localhost
+	ip := "localhost"
+	if !tcpAddr.IP.IsUnspecified() {
+		ip = tcpAddr.IP.String()
+	}
+	return a.client.HookSyncMsg(a.ctx, ip, tcpAddr.Port)
 }
 
-func (a *APIServer) Run(addr string) error {
+// isDuplicate reports whether the message has been put into the buffer before.
+func (a *APIServer) isDuplicate(message *Message) bool {
+	if a.Deduplicator == nil {
+		return false
+	}
+	duplicate, err := a.Deduplicator.Duplicate(a.ctx, message.MsgId, message.MsgSequence)
+	if err != nil {
+		log.Ctx(a.ctx).Error().Err(err).Int64("msgId", message.MsgId).Msg("deduplicate message failed")
+		return false
+	}
+	if duplicate {
+		log.Ctx(a.ctx).Warn().
+			Int64("msgId", message.MsgId).
+			Int64("suppressed", a.Deduplicator.Suppressed()).
+			Msg("duplicate message suppressed")
+	}
+	return duplicate
+}
+
+// Start 开始接收消息并检查登录状态，返回 APIServer 的 http.Handler。
+// APIServer 在 Context 结束或者微信退出登录后停止。
+func (a *APIServer) Start() (http.Handler, error) {
 	if a.Context == nil {
 		a.Context = context.Background()
 	}
 	a.ctx, a.stop = context.WithCancelCause(a.Context)
 	if err := a.startListen(); err != nil {
+		a.stop(err)
+		return nil, err
+	}
+	go a.checker.Check(a.ctx)
+	return registerAPIServer(a), nil
+}
+
+func (a *APIServer) Run(addr string) error {
+	handler, err := a.Start()
+	if err != nil {
 		return err
 	}
 	srv := &http.Server{
 		Addr:    addr,
-		Handler: registerAPIServer(a),
+		Handler: handler,
 	}
-	go a.checker.Check(a.ctx)
 	return srv.ListenAndServe()
 }
 
@@ -366,11 +491,29 @@ func New(client *wxclient.Client, fileMergerFactory filemerger.Factory, msgBuffe
 		client:            client,
 		msgBuffer:         msgBuffer,
 		fileMergerFactory: fileMergerFactory,
+		MediaDir:          env.Name("WECHAT_DATA_DIR").String(),
 	}
 	srv.checker = &loginChecker{srv: srv, loopInterval: time.Second / 5}
 	return srv
 }
 
+// NewWithInjectServer 返回连接到 injectServerURL 的 APIServer，用于本地测试。
+// 消息队列和上传文件的缓存都在内存中，不读取环境变量，不会连接 MSG_QUEUE_ADDR 或者 REDIS_ADDR 的 redis。
+func NewWithInjectServer(injectServerURL string) *APIServer {
+	srv := New(wxclient.New(wxclient.NewTransport(injectServerURL)), filemerger.MemoryFactory(), msgbuffer.NewMemoryMessageBuffer(100))
+	srv.MediaDir = ""
+	return srv
+}
+
+// Default 返回使用环境变量配置的 APIServer，并且开启消息去重
 func Default() *APIServer {
-	return New(wxclient.Default(), filemerger.DefaultFactory(), msgbuffer.Default())
+	msgBuffer := msgbuffer.Default()
+	srv := New(wxclient.Default(), filemerger.DefaultFactory(), msgBuffer)
+	// 使用 redis 作为消息队列时，重启之后依然需要去重，和消息队列共用一个连接
+	if buffer, ok := msgBuffer.(*msgbuffer.RedisMessageBuffer); ok {
+		srv.Deduplicator = dedup.New(dedup.NewRedisStore(buffer.Client(), dedup.APIServerPrefix, 24*time.Hour))
+	} else {
+		srv.Deduplicator = dedup.New(dedup.NewMemoryStore(10000, 24*time.Hour))
+	}
+	return srv
 }
@@ -0,0 +1,79 @@
+package apiserver
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDisplayNames(t *testing.T) {
+	cases := []struct {
+		memberNickname string
+		n              int
+		expected       []string
+	}{
+		{"小A^G小B^G小C", 3, []string{"小A", "小B", "小C"}},
+		// 中间没有设置群昵称的成员
+		{"小A^G^G小C", 3, []string{"小A", "", "小C"}},
+		// 末尾的空群昵称被省略
+		{"小A^G小B", 3, []string{"小A", "小B", ""}},
+		{"", 2, []string{"", ""}},
+		// 多出来的群昵称被忽略
+		{"小A^G小B^G小C", 2, []string{"小A", "小B"}},
+	}
+	for _, c := range cases {
+		if names := displayNames(c.memberNickname, c.n); !reflect.DeepEqual(names, c.expected) {
+			t.Fatalf("%q: expected %q, got %q", c.memberNickname, c.expected, names)
+		}
+	}
+}
+
+func TestResolveMediaPath(t *testing.T) {
+	srv := &APIServer{MediaDir: t.TempDir()}
+	file := func(title string) string {
+		return "<msg><appmsg><title>" + title + "</title><type>6</type></appmsg></msg>"
+	}
+	// 不能通过 FromUser 或者文件名跳出 MediaDir
+	requests := []DownloadMediaRequest{
+		{MsgID: 1, Type: mediaTypeVideo, FromUser: "../../etc"},
+		{MsgID: 1, Type: mediaTypeVideo, FromUser: ".."},
+		{MsgID: 1, Type: mediaTypeVideo, FromUser: ""},
+		{MsgID: 1, Type: mediaTypeApp, FromUser: `wxid_a\..\..`, Content: file("passwd")},
+		{MsgID: 1, Type: mediaTypeApp, FromUser: "wxid_a", Content: file("..")},
+		{MsgID: 1, Type: mediaTypeApp, FromUser: "wxid_a", Content: file("../../passwd")},
+	}
+	for _, req := range requests {
+		if _, err := srv.resolveMedia(context.Background(), req); err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Fatalf("%+v: expected invalid path error, got %v", req, err)
+		}
+	}
+	if !isSubPath("/data", "/data/wxhelper/file/wxid_a/a..b.txt") {
+		t.Fatal("expected a..b.txt to be under /data")
+	}
+	if isSubPath("/data", "/data/../etc/passwd") || isSubPath("/data", "/database") {
+		t.Fatal("expected paths outside of /data to be rejected")
+	}
+}
+
+func TestCheckEmoticonURL(t *testing.T) {
+	cases := []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://emoji.qpic.cn/wx_emoji/abc/0", true},
+		{"https://vweixinf.tc.qq.com/110/20401/stodownload?m=abc", true},
+		{"http://EMOJI.qpic.cn/wx_emoji/abc/0", true},
+		{"http://127.0.0.1:8080/api/userinfo", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://emoji.qpic.cn.evil.com/a", false},
+		{"http://evilemoji.qpic.cn/a", false},
+		{"file:///etc/passwd", false},
+		{"gopher://emoji.qpic.cn/a", false},
+	}
+	for _, c := range cases {
+		if err := checkEmoticonURL(c.url); (err == nil) != c.allowed {
+			t.Fatalf("%s: expected allowed %v, got %v", c.url, c.allowed, err)
+		}
+	}
+}
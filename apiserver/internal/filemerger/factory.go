@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/eatmoreapple/wxhelper/apiserver/internal/filemerger/internal"
 	"strings"
+	"sync"
 	_ "unsafe"
 )
 
@@ -49,3 +50,9 @@ func DefaultFactory() Factory {
 	cache := internal.CacheFromEnv()
 	return &localFileMergerFactory{cache: cache}
 }
+
+// MemoryFactory creates a new Factory which keeps the uploaded chunks in memory,
+// it does not read any environment variable.
+func MemoryFactory() Factory {
+	return &localFileMergerFactory{cache: internal.NewMemoryCache(new(sync.Map))}
+}
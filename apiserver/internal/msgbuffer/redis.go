@@ -44,6 +44,11 @@ func (r RedisMessageBuffer) Get(ctx context.Context, timeout time.Duration) (*Me
 	return &msg, nil
 }
 
+// Client returns the redis client of the buffer.
+func (r RedisMessageBuffer) Client() *redis.Client {
+	return r.client
+}
+
 func NewRedisMessageBuffer(client *redis.Client, queue string) *RedisMessageBuffer {
 	if queue == "" {
 		queue = "wechat:message:queue"
@@ -50,6 +50,11 @@ func (t *TCPMessageListener) ListenAndServe(messageHandler MessageHandler) error
 	if err != nil {
 		return err
 	}
+	return t.Serve(listener, messageHandler)
+}
+
+// Serve 在已经监听的 listener 上接收消息，返回时关闭 listener
+func (t *TCPMessageListener) Serve(listener net.Listener, messageHandler MessageHandler) error {
 	defer func() { _ = listener.Close() }()
 	for {
 		conn, err := listener.Accept()
@@ -0,0 +1,230 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 可以下载的媒体消息的类型
+const (
+	mediaTypeVoice    = 34
+	mediaTypeVideo    = 43
+	mediaTypeEmoticon = 47
+	mediaTypeApp      = 49
+)
+
+// ErrMediaNotFound 表示等待超时之后媒体文件依然不存在
+var ErrMediaNotFound = errors.New("media not found")
+
+// emoticonHosts 是微信表情 cdn 的域名，只代理这些域名及其子域名下的地址
+var emoticonHosts = []string{"emoji.qpic.cn", "mmbiz.qpic.cn", "wxapp.tc.qq.com", "vweixinf.tc.qq.com"}
+
+type DownloadMediaRequest struct {
+	MsgID    int64  `json:"msgId"`
+	Type     int    `json:"type"`
+	FromUser string `json:"fromUser"`
+	// Content 是消息的内容，用于解析文件名和表情的地址
+	Content string `json:"content"`
+}
+
+// DownloadMedia 下载语音、视频、文件和表情，成功时直接返回文件的内容
+func (a *APIServer) DownloadMedia(c *gin.Context) {
+	var req DownloadMediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, Err[any](err.Error()))
+		return
+	}
+	if req.Type == mediaTypeEmoticon {
+		if err := a.proxyEmoticon(c, req); err != nil {
+			log.Ctx(c.Request.Context()).Error().Err(err).Int64("msgId", req.MsgID).Msg("download emoticon")
+			c.JSON(http.StatusOK, Err[any](err.Error()))
+		}
+		return
+	}
+	path, err := a.resolveMedia(c.Request.Context(), req)
+	if err != nil {
+		log.Ctx(c.Request.Context()).Error().Err(err).Int64("msgId", req.MsgID).Msg("download media")
+		c.JSON(http.StatusOK, Err[any](err.Error()))
+		return
+	}
+	c.FileAttachment(path, filepath.Base(path))
+}
+
+// resolveMedia 让注入服务器把媒体文件保存到 CurrentDataPath 下，然后从共享的 MediaDir 中读取
+func (a *APIServer) resolveMedia(ctx context.Context, req DownloadMediaRequest) (string, error) {
+	if a.MediaDir == "" {
+		return "", errors.New("media dir is not configured")
+	}
+	// FromUser 和文件名会拼接到路径中，不能跳出 MediaDir
+	if req.Type != mediaTypeVoice && !isPathElement(req.FromUser) {
+		return "", fmt.Errorf("invalid from user %q", req.FromUser)
+	}
+	msgID := strconv.FormatInt(req.MsgID, 10)
+	var path string
+	switch req.Type {
+	case mediaTypeVoice:
+		account, err := a.client.GetUserInfo(ctx)
+		if err != nil {
+			return "", err
+		}
+		dir := filepath.Join(a.MediaDir, "wxhelper", "voice")
+		if err = os.MkdirAll(dir, 0o755); err != nil {
+			return "", err
+		}
+		storeDir := strings.TrimRight(account.CurrentDataPath, `\`) + `\wxhelper\voice`
+		if err = a.client.GetVoiceByMsgID(ctx, req.MsgID, storeDir); err != nil {
+			return "", err
+		}
+		path = filepath.Join(dir, msgID+".amr")
+	case mediaTypeVideo:
+		path = filepath.Join(a.MediaDir, "wxhelper", "video", req.FromUser, msgID+".mp4")
+	case mediaTypeApp:
+		title, err := parseAttachTitle(req.Content)
+		if err != nil {
+			return "", err
+		}
+		if !isPathElement(title) {
+			return "", fmt.Errorf("invalid file name %q", title)
+		}
+		path = filepath.Join(a.MediaDir, "wxhelper", "file", req.FromUser, title)
+	default:
+		return "", fmt.Errorf("unsupported media type %d", req.Type)
+	}
+	if !isSubPath(a.MediaDir, path) {
+		return "", fmt.Errorf("media path %s is outside of the media dir", path)
+	}
+	if req.Type != mediaTypeVoice {
+		// 已经下载过的附件直接返回
+		if stat, err := os.Stat(path); err == nil && stat.Size() > 0 {
+			return path, nil
+		}
+		if err := a.client.DownloadAttach(ctx, req.MsgID); err != nil {
+			return "", err
+		}
+	}
+	return path, waitMediaFile(ctx, path, 30*time.Second)
+}
+
+// isPathElement 判断 name 是否可以作为单独的一级路径
+func isPathElement(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\\x00")
+}
+
+// isSubPath 判断 path 是否在 dir 下
+func isSubPath(dir, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// waitMediaFile 等待微信下载完成
+func waitMediaFile(ctx context.Context, path string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(time.Second / 5)
+	defer ticker.Stop()
+	for {
+		if stat, err := os.Stat(path); err == nil && stat.Size() > 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ErrMediaNotFound
+		case <-ticker.C:
+		}
+	}
+}
+
+// proxyEmoticon 从表情的 cdn 地址下载并返回
+func (a *APIServer) proxyEmoticon(c *gin.Context, req DownloadMediaRequest) error {
+	var msg struct {
+		Emoji struct {
+			CDNURL string `xml:"cdnurl,attr"`
+		} `xml:"emoji"`
+	}
+	if err := xml.Unmarshal([]byte(xmlContent(req.Content)), &msg); err != nil {
+		return err
+	}
+	if msg.Emoji.CDNURL == "" {
+		return errors.New("emoticon url not found")
+	}
+	if err := checkEmoticonURL(msg.Emoji.CDNURL); err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, msg.Emoji.CDNURL, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		// 重定向的地址同样需要检查
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return checkEmoticonURL(req.URL.String())
+		},
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download emoticon failed with status %d", resp.StatusCode)
+	}
+	c.DataFromReader(http.StatusOK, resp.ContentLength, resp.Header.Get("Content-Type"), resp.Body, nil)
+	return nil
+}
+
+// checkEmoticonURL 只允许 http(s) 协议和微信表情 cdn 的域名，避免被用来访问内网地址
+func checkEmoticonURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported emoticon url scheme %q", u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range emoticonHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("emoticon host %q is not allowed", host)
+}
+
+// parseAttachTitle 解析文件消息的文件名
+func parseAttachTitle(content string) (string, error) {
+	var msg struct {
+		AppMsg struct {
+			Title string `xml:"title"`
+			Type  int    `xml:"type"`
+		} `xml:"appmsg"`
+	}
+	if err := xml.Unmarshal([]byte(xmlContent(content)), &msg); err != nil {
+		return "", err
+	}
+	if msg.AppMsg.Type != 6 || msg.AppMsg.Title == "" {
+		return "", errors.New("not a file message")
+	}
+	return msg.AppMsg.Title, nil
+}
+
+// xmlContent 去掉群消息开头的 "wxid:\n"
+func xmlContent(content string) string {
+	if index := strings.Index(content, "<"); index > 0 {
+		return content[index:]
+	}
+	return content
+}
@@ -0,0 +1,82 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"github.com/eatmoreapple/wxhelper/internal/wxclient"
+	"strconv"
+)
+
+// appMessageQuote 是引用回复的 appmsg 类型
+const appMessageQuote = 57
+
+type SendQuoteRequest struct {
+	To      string `json:"to"`
+	Content string `json:"content"`
+	// MsgID 是被引用的消息的 id
+	MsgID int64 `json:"msgId"`
+	// SenderID 是被引用的消息在群里的发送者，私聊时为空
+	SenderID      string `json:"senderId"`
+	SenderName    string `json:"senderName"`
+	QuotedType    int    `json:"quotedType"`
+	QuotedContent string `json:"quotedContent"`
+	QuotedTime    int64  `json:"quotedTime"`
+}
+
+// quoteMessage 是引用回复的 xml
+type quoteMessage struct {
+	XMLName xml.Name        `xml:"msg"`
+	AppMsg  quoteAppMessage `xml:"appmsg"`
+}
+
+type quoteAppMessage struct {
+	AppID    string `xml:"appid,attr"`
+	SDKVer   string `xml:"sdkver,attr"`
+	Title    string `xml:"title"`
+	Des      string `xml:"des"`
+	Type     int    `xml:"type"`
+	ReferMsg struct {
+		Type        int    `xml:"type"`
+		SvrID       string `xml:"svrid"`
+		FromUsr     string `xml:"fromusr"`
+		ChatUsr     string `xml:"chatusr"`
+		DisplayName string `xml:"displayname"`
+		Content     string `xml:"content"`
+		CreateTime  int64  `xml:"createtime"`
+	} `xml:"refermsg"`
+}
+
+func (req SendQuoteRequest) appMessage() (string, error) {
+	app := quoteAppMessage{SDKVer: "0", Title: req.Content, Type: appMessageQuote}
+	app.ReferMsg.Type = req.QuotedType
+	app.ReferMsg.SvrID = strconv.FormatInt(req.MsgID, 10)
+	app.ReferMsg.FromUsr = req.To
+	app.ReferMsg.ChatUsr = req.SenderID
+	app.ReferMsg.DisplayName = req.SenderName
+	app.ReferMsg.Content = req.QuotedContent
+	app.ReferMsg.CreateTime = req.QuotedTime
+	data, err := xml.Marshal(quoteMessage{AppMsg: app})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// SendQuote 引用消息回复
+func (a *APIServer) SendQuote(ctx context.Context, req SendQuoteRequest) (*Result[any], error) {
+	content, err := req.appMessage()
+	if err != nil {
+		return nil, err
+	}
+	err = a.client.SendAppMsg(ctx, req.To, content)
+	// 注入服务器没有接口时，客户端降级为文本回复。
+	// 其他失败时消息可能已经发出，返回错误，避免客户端重复回复
+	if errors.Is(err, wxclient.ErrUnsupported) {
+		return &Result[any]{Code: resultCodeUnsupported, Msg: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return OK[any](nil), nil
+}
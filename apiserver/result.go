@@ -6,6 +6,11 @@ const (
 	resultCodeOk resultCode = iota
 	resultCodeErr
 	resultCodeAuthErr
+	resultCodeUnsupported
+	// resultCodeNotGroupAdmin 不是群主或者管理员
+	resultCodeNotGroupAdmin
+	// resultCodeNotGroupMember 成员不在群里
+	resultCodeNotGroupMember
 )
 
 type Result[T any] struct {
@@ -90,6 +90,10 @@ func registerAPIServer(server *APIServer) http.Handler {
 		router.POST(ForwardMsg, ginx.G(server.ForwardMsg).JSON())
 		router.POST(UploadFile, ginx.G(server.UploadFile).JSON())
 		router.POST(QuitChatRoom, ginx.G(server.QuitChatRoom).JSON())
+		engine.POST(DownloadMedia, server.DownloadMedia)
+		router.POST(SendQuote, ginx.G(server.SendQuote).JSON())
+		router.POST(DelMemberFromChatRoom, ginx.G(server.DelMemberFromChatRoom).JSON())
+		router.POST(ModifyNickname, ginx.G(server.ModifyNickname).JSON())
 	}
 	return engine.Handler()
 }
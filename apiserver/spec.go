@@ -16,4 +16,8 @@ const (
 	ForwardMsg             = "/api/forward-msg"
 	UploadFile             = "/api/upload-file"
 	QuitChatRoom           = "/api/quit-chat-room"
+	DownloadMedia          = "/api/download-media"
+	SendQuote              = "/api/send-quote"
+	DelMemberFromChatRoom  = "/api/del-member-from-chatroom"
+	ModifyNickname         = "/api/modify-nickname"
 )
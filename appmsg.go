@@ -0,0 +1,373 @@
+package wxhelper
+
+import (
+	"encoding/xml"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrNotAppMessage is returned when parsing a message which is not an app message.
+var ErrNotAppMessage = errors.New("not an app message")
+
+// AppMessageType type 49 消息中 appmsg 的类型
+type AppMessageType int
+
+const (
+	AppMessageMusic            AppMessageType = 3
+	AppMessageLink             AppMessageType = 5
+	AppMessageFile             AppMessageType = 6
+	AppMessageChatRecord       AppMessageType = 19
+	AppMessageMiniProgram      AppMessageType = 33
+	AppMessageMiniProgramShare AppMessageType = 36
+	AppMessageQuote            AppMessageType = 57
+	AppMessageTransfer         AppMessageType = 2000
+)
+
+// AppMessage 解析后的 type 49 消息，具体类型为
+// *LinkShare、*FileAttachment、*MiniProgram、*Music、*QuoteReply、*ChatRecord、*Transfer
+// 或者 *UnknownAppMessage
+type AppMessage interface {
+	AppType() AppMessageType
+}
+
+// LinkShare 分享的链接
+type LinkShare struct {
+	Title       string
+	Description string
+	URL         string
+	ThumbURL    string
+	// SourceName is the display name of the official account or app the link comes from.
+	SourceName string
+}
+
+func (*LinkShare) AppType() AppMessageType { return AppMessageLink }
+
+// FileAttachment 文件
+type FileAttachment struct {
+	Name     string
+	Ext      string
+	Size     int64
+	MD5      string
+	AttachID string
+}
+
+func (*FileAttachment) AppType() AppMessageType { return AppMessageFile }
+
+// MiniProgram 小程序
+type MiniProgram struct {
+	Type        AppMessageType
+	Title       string
+	Description string
+	// SourceName is the display name of the mini program.
+	SourceName string
+	Username   string
+	AppID      string
+	PagePath   string
+	ThumbURL   string
+}
+
+func (m *MiniProgram) AppType() AppMessageType { return m.Type }
+
+// Music 音乐
+type Music struct {
+	Title   string
+	Singer  string
+	URL     string
+	DataURL string
+}
+
+func (*Music) AppType() AppMessageType { return AppMessageMusic }
+
+// QuoteReply 引用回复
+type QuoteReply struct {
+	// Content is the text of the reply.
+	Content string
+	// Refer is the quoted message.
+	Refer ReferMessage
+}
+
+func (*QuoteReply) AppType() AppMessageType { return AppMessageQuote }
+
+// ReferMessage 被引用的消息
+type ReferMessage struct {
+	Type  int
+	MsgId int64
+	// FromUser is the chat the quoted message is sent in.
+	FromUser string
+	// ChatUser is the sender of the quoted message in a group, empty for private chats.
+	ChatUser    string
+	DisplayName string
+	// Content is the content of the quoted message, it is XML if the quoted message is not a text.
+	Content    string
+	CreateTime int64
+}
+
+// ChatRecord 合并转发的聊天记录
+type ChatRecord struct {
+	Title       string
+	Description string
+	Items       []ChatRecordItem
+}
+
+func (*ChatRecord) AppType() AppMessageType { return AppMessageChatRecord }
+
+// ChatRecordItem 聊天记录中的一条消息
+type ChatRecordItem struct {
+	DataType   int
+	SourceName string
+	SourceTime string
+	Content    string
+}
+
+// TransferStatus 转账状态
+type TransferStatus int
+
+const (
+	TransferPending  TransferStatus = 1
+	TransferReceived TransferStatus = 3
+	TransferRefunded TransferStatus = 4
+)
+
+// Transfer 转账
+type Transfer struct {
+	Status TransferStatus
+	// Amount is the formatted amount, like "￥0.10".
+	Amount        string
+	Memo          string
+	TransactionID string
+	TransferID    string
+	Payer         string
+	Receiver      string
+	InvalidTime   int64
+}
+
+func (*Transfer) AppType() AppMessageType { return AppMessageTransfer }
+
+// UnknownAppMessage 暂不支持解析的 app 消息
+type UnknownAppMessage struct {
+	Type        AppMessageType
+	Title       string
+	Description string
+	URL         string
+	XML         string
+}
+
+func (u *UnknownAppMessage) AppType() AppMessageType { return u.Type }
+
+type appMessageXML struct {
+	AppMsg struct {
+		Title             string `xml:"title"`
+		Des               string `xml:"des"`
+		Type              int    `xml:"type"`
+		URL               string `xml:"url"`
+		DataURL           string `xml:"dataurl"`
+		ThumbURL          string `xml:"thumburl"`
+		MD5               string `xml:"md5"`
+		SourceDisplayName string `xml:"sourcedisplayname"`
+		SourceUsername    string `xml:"sourceusername"`
+		RecordItem        string `xml:"recorditem"`
+		AppAttach         struct {
+			TotalLen int64  `xml:"totallen"`
+			AttachID string `xml:"attachid"`
+			FileExt  string `xml:"fileext"`
+		} `xml:"appattach"`
+		WeAppInfo struct {
+			Username string `xml:"username"`
+			AppID    string `xml:"appid"`
+			PagePath string `xml:"pagepath"`
+		} `xml:"weappinfo"`
+		ReferMsg struct {
+			Type        int    `xml:"type"`
+			SvrID       string `xml:"svrid"`
+			FromUsr     string `xml:"fromusr"`
+			ChatUsr     string `xml:"chatusr"`
+			DisplayName string `xml:"displayname"`
+			Content     string `xml:"content"`
+			CreateTime  int64  `xml:"createtime"`
+		} `xml:"refermsg"`
+		WCPayInfo struct {
+			PaySubType       int    `xml:"paysubtype"`
+			FeeDesc          string `xml:"feedesc"`
+			TranscationID    string `xml:"transcationid"`
+			TransferID       string `xml:"transferid"`
+			InvalidTime      int64  `xml:"invalidtime"`
+			PayMemo          string `xml:"pay_memo"`
+			PayerUsername    string `xml:"payer_username"`
+			ReceiverUsername string `xml:"receiver_username"`
+		} `xml:"wcpayinfo"`
+	} `xml:"appmsg"`
+}
+
+type recordInfoXML struct {
+	Title    string `xml:"title"`
+	Desc     string `xml:"desc"`
+	DataList struct {
+		Items []struct {
+			DataType   int    `xml:"datatype,attr"`
+			SourceName string `xml:"sourcename"`
+			SourceTime string `xml:"sourcetime"`
+			DataDesc   string `xml:"datadesc"`
+		} `xml:"dataitem"`
+	} `xml:"datalist"`
+}
+
+// unmarshalXML 微信的 xml 并不总是规范的，所以使用非严格模式解析
+func unmarshalXML(data string, v any) error {
+	decoder := xml.NewDecoder(strings.NewReader(data))
+	decoder.Strict = false
+	return decoder.Decode(v)
+}
+
+// ParseAppMessage parses the content of a type 49 message.
+// The "wxid:\n" sender prefix of group messages is ignored.
+func ParseAppMessage(content string) (AppMessage, error) {
+	index := strings.Index(content, "<")
+	if index < 0 {
+		return nil, ErrNotAppMessage
+	}
+	content = content[index:]
+	var msg appMessageXML
+	if err := unmarshalXML(content, &msg); err != nil {
+		return nil, err
+	}
+	app := msg.AppMsg
+	switch appType := AppMessageType(app.Type); appType {
+	case AppMessageLink:
+		return &LinkShare{
+			Title:       app.Title,
+			Description: app.Des,
+			URL:         app.URL,
+			ThumbURL:    app.ThumbURL,
+			SourceName:  app.SourceDisplayName,
+		}, nil
+	case AppMessageFile:
+		return &FileAttachment{
+			Name:     app.Title,
+			Ext:      app.AppAttach.FileExt,
+			Size:     app.AppAttach.TotalLen,
+			MD5:      app.MD5,
+			AttachID: app.AppAttach.AttachID,
+		}, nil
+	case AppMessageMiniProgram, AppMessageMiniProgramShare:
+		return &MiniProgram{
+			Type:        appType,
+			Title:       app.Title,
+			Description: app.Des,
+			SourceName:  app.SourceDisplayName,
+			Username:    app.WeAppInfo.Username,
+			AppID:       app.WeAppInfo.AppID,
+			PagePath:    app.WeAppInfo.PagePath,
+			ThumbURL:    app.ThumbURL,
+		}, nil
+	case AppMessageMusic:
+		return &Music{
+			Title:   app.Title,
+			Singer:  app.Des,
+			URL:     app.URL,
+			DataURL: app.DataURL,
+		}, nil
+	case AppMessageQuote:
+		refer := app.ReferMsg
+		msgID, _ := strconv.ParseInt(refer.SvrID, 10, 64)
+		return &QuoteReply{
+			Content: app.Title,
+			Refer: ReferMessage{
+				Type:        refer.Type,
+				MsgId:       msgID,
+				FromUser:    refer.FromUsr,
+				ChatUser:    refer.ChatUsr,
+				DisplayName: refer.DisplayName,
+				Content:     refer.Content,
+				CreateTime:  refer.CreateTime,
+			},
+		}, nil
+	case AppMessageChatRecord:
+		record := &ChatRecord{Title: app.Title, Description: app.Des}
+		if strings.TrimSpace(app.RecordItem) == "" {
+			return record, nil
+		}
+		var info recordInfoXML
+		if err := unmarshalXML(app.RecordItem, &info); err != nil {
+			return nil, err
+		}
+		for _, item := range info.DataList.Items {
+			record.Items = append(record.Items, ChatRecordItem{
+				DataType:   item.DataType,
+				SourceName: item.SourceName,
+				SourceTime: item.SourceTime,
+				Content:    item.DataDesc,
+			})
+		}
+		return record, nil
+	case AppMessageTransfer:
+		pay := app.WCPayInfo
+		return &Transfer{
+			Status:        TransferStatus(pay.PaySubType),
+			Amount:        pay.FeeDesc,
+			Memo:          pay.PayMemo,
+			TransactionID: pay.TranscationID,
+			TransferID:    pay.TransferID,
+			Payer:         pay.PayerUsername,
+			Receiver:      pay.ReceiverUsername,
+			InvalidTime:   pay.InvalidTime,
+		}, nil
+	default:
+		return &UnknownAppMessage{
+			Type:        appType,
+			Title:       app.Title,
+			Description: app.Des,
+			URL:         app.URL,
+			XML:         content,
+		}, nil
+	}
+}
+
+// AppMessage parses the content of a type 49 message.
+func (m Message) AppMessage() (AppMessage, error) {
+	if !m.IsAppMessage() {
+		return nil, ErrNotAppMessage
+	}
+	return ParseAppMessage(m.Content)
+}
+
+func (m Message) isAppMessageOf(types ...AppMessageType) bool {
+	app, err := m.AppMessage()
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if app.AppType() == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (m Message) IsLinkShare() bool {
+	return m.isAppMessageOf(AppMessageLink)
+}
+
+func (m Message) IsFileAttachment() bool {
+	return m.isAppMessageOf(AppMessageFile)
+}
+
+func (m Message) IsMiniProgram() bool {
+	return m.isAppMessageOf(AppMessageMiniProgram, AppMessageMiniProgramShare)
+}
+
+func (m Message) IsMusic() bool {
+	return m.isAppMessageOf(AppMessageMusic)
+}
+
+func (m Message) IsQuoteReply() bool {
+	return m.isAppMessageOf(AppMessageQuote)
+}
+
+func (m Message) IsChatRecord() bool {
+	return m.isAppMessageOf(AppMessageChatRecord)
+}
+
+func (m Message) IsTransfer() bool {
+	return m.isAppMessageOf(AppMessageTransfer)
+}
@@ -0,0 +1,141 @@
+package wxhelper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readAppMessage(t *testing.T, name string) AppMessage {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "appmsg", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := ParseAppMessage(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestParseLinkShare(t *testing.T) {
+	link, ok := readAppMessage(t, "link.xml").(*LinkShare)
+	if !ok {
+		t.Fatal("expected *LinkShare")
+	}
+	if link.Title != "Go 1.22 发布了" {
+		t.Fatalf("expected Go 1.22 发布了, got %s", link.Title)
+	}
+	if link.URL != "https://mp.weixin.qq.com/s/AbCdEfGhIjKlMnOp" {
+		t.Fatalf("unexpected url %s", link.URL)
+	}
+	if link.SourceName != "Go语言中文网" {
+		t.Fatalf("expected Go语言中文网, got %s", link.SourceName)
+	}
+}
+
+func TestParseFileAttachment(t *testing.T) {
+	file, ok := readAppMessage(t, "file.xml").(*FileAttachment)
+	if !ok {
+		t.Fatal("expected *FileAttachment")
+	}
+	if file.Name != "2024年度报告.pdf" || file.Ext != "pdf" {
+		t.Fatalf("unexpected file %s.%s", file.Name, file.Ext)
+	}
+	if file.Size != 1048576 {
+		t.Fatalf("expected 1048576, got %d", file.Size)
+	}
+	if file.MD5 != "d41d8cd98f00b204e9800998ecf8427e" {
+		t.Fatalf("unexpected md5 %s", file.MD5)
+	}
+}
+
+func TestParseMiniProgram(t *testing.T) {
+	program, ok := readAppMessage(t, "miniprogram.xml").(*MiniProgram)
+	if !ok {
+		t.Fatal("expected *MiniProgram")
+	}
+	if program.AppID != "wx1234567890abcdef" {
+		t.Fatalf("expected wx1234567890abcdef, got %s", program.AppID)
+	}
+	if program.PagePath != "pages/index/index.html?from=share" {
+		t.Fatalf("unexpected page path %s", program.PagePath)
+	}
+	if program.SourceName != "美食助手" {
+		t.Fatalf("expected 美食助手, got %s", program.SourceName)
+	}
+}
+
+func TestParseMusic(t *testing.T) {
+	music, ok := readAppMessage(t, "music.xml").(*Music)
+	if !ok {
+		t.Fatal("expected *Music")
+	}
+	if music.Title != "晴天" || music.Singer != "周杰伦" {
+		t.Fatalf("unexpected music %s - %s", music.Title, music.Singer)
+	}
+}
+
+func TestParseQuoteReply(t *testing.T) {
+	quote, ok := readAppMessage(t, "quote_group.txt").(*QuoteReply)
+	if !ok {
+		t.Fatal("expected *QuoteReply")
+	}
+	if quote.Content != "明天几点开会？" {
+		t.Fatalf("expected 明天几点开会？, got %s", quote.Content)
+	}
+	if quote.Refer.MsgId != 7123456789012345678 {
+		t.Fatalf("expected 7123456789012345678, got %d", quote.Refer.MsgId)
+	}
+	if quote.Refer.ChatUser != "wxid_member02" || quote.Refer.DisplayName != "张三" {
+		t.Fatalf("unexpected refer sender %s(%s)", quote.Refer.DisplayName, quote.Refer.ChatUser)
+	}
+	if quote.Refer.Content != "周会改到明天了" {
+		t.Fatalf("expected 周会改到明天了, got %s", quote.Refer.Content)
+	}
+}
+
+func TestParseChatRecord(t *testing.T) {
+	record, ok := readAppMessage(t, "chatrecord.xml").(*ChatRecord)
+	if !ok {
+		t.Fatal("expected *ChatRecord")
+	}
+	if len(record.Items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(record.Items))
+	}
+	if record.Items[1].SourceName != "李四" || record.Items[1].Content != "收到" {
+		t.Fatalf("unexpected item %s: %s", record.Items[1].SourceName, record.Items[1].Content)
+	}
+}
+
+func TestParseTransfer(t *testing.T) {
+	transfer, ok := readAppMessage(t, "transfer.xml").(*Transfer)
+	if !ok {
+		t.Fatal("expected *Transfer")
+	}
+	if transfer.Status != TransferPending {
+		t.Fatalf("expected %d, got %d", TransferPending, transfer.Status)
+	}
+	if transfer.Amount != "￥0.10" || transfer.Memo != "午饭钱" {
+		t.Fatalf("unexpected transfer %s %s", transfer.Amount, transfer.Memo)
+	}
+	if transfer.Payer != "wxid_payer" || transfer.Receiver != "wxid_receiver" {
+		t.Fatalf("unexpected transfer %s -> %s", transfer.Payer, transfer.Receiver)
+	}
+}
+
+func TestMessageAppMessage(t *testing.T) {
+	msg := Message{Type: 1, Content: "hello"}
+	if _, err := msg.AppMessage(); err != ErrNotAppMessage {
+		t.Fatalf("expected %v, got %v", ErrNotAppMessage, err)
+	}
+	data, err := os.ReadFile(filepath.Join("testdata", "appmsg", "link.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg = Message{Type: 49, Content: string(data)}
+	if !msg.IsLinkShare() || msg.IsFileAttachment() {
+		t.Fatal("expected link share")
+	}
+}
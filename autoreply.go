@@ -0,0 +1,437 @@
+package wxhelper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AutoReplyRule 一条自动回复规则，匹配条件同时满足时执行动作
+type AutoReplyRule struct {
+	Name string `yaml:"name"`
+
+	// Exact matches the text equal to one of them.
+	Exact []string `yaml:"exact"`
+	// Contains matches the text containing one of them.
+	Contains []string `yaml:"contains"`
+	// Regex matches the text by the regular expression.
+	Regex string `yaml:"regex"`
+	// Chat is "group", "private" or empty for both.
+	Chat string `yaml:"chat"`
+	// Senders only accepts the messages sent by these wxids if not empty.
+	Senders []string `yaml:"senders"`
+	// Groups only accepts the messages sent in these groups if not empty.
+	Groups []string `yaml:"groups"`
+	// Time is the local time window such as "09:00-18:00", it may cross midnight.
+	Time string `yaml:"time"`
+
+	// Reply is the text to reply.
+	Reply string `yaml:"reply"`
+	// Image is the image file to reply, relative to the rule file.
+	Image string `yaml:"image"`
+	// Forward is the wxid of the user or group to forward the message to.
+	Forward string `yaml:"forward"`
+	// Mention mentions the sender in the reply of a group message.
+	Mention bool `yaml:"mention"`
+	// Continue goes on matching the following rules after this one.
+	Continue bool `yaml:"continue"`
+
+	regex      *regexp.Regexp
+	from, to   time.Duration
+	senders    map[string]empty
+	groups     map[string]empty
+	imagePath  string
+	timeWindow bool
+}
+
+type autoReplyFile struct {
+	Rules []*AutoReplyRule `yaml:"rules"`
+}
+
+// RuleError 是一条规则的错误
+type RuleError struct {
+	Index int
+	Name  string
+	Err   error
+}
+
+func (e *RuleError) Error() string {
+	// 一条规则的多个错误显示在同一行
+	reason := strings.ReplaceAll(e.Err.Error(), "\n", "; ")
+	if e.Name != "" {
+		return fmt.Sprintf("rule %d (%s): %s", e.Index+1, e.Name, reason)
+	}
+	return fmt.Sprintf("rule %d: %s", e.Index+1, reason)
+}
+
+func (e *RuleError) Unwrap() error { return e.Err }
+
+// compile validates the rule and prepares it for matching, dir is the directory of the rule file.
+func (r *AutoReplyRule) compile(dir string) error {
+	var errs []error
+	if len(r.Exact) == 0 && len(r.Contains) == 0 && r.Regex == "" {
+		errs = append(errs, errors.New("no exact, contains or regex to match"))
+	}
+	if r.Regex != "" {
+		regex, err := regexp.Compile(r.Regex)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid regex: %w", err))
+		}
+		r.regex = regex
+	}
+	switch r.Chat {
+	case "", "group", "private":
+	default:
+		errs = append(errs, fmt.Errorf("invalid chat %q, expected group or private", r.Chat))
+	}
+	if r.Time != "" {
+		if err := r.parseTime(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if r.Reply == "" && r.Image == "" && r.Forward == "" {
+		errs = append(errs, errors.New("no reply, image or forward to do"))
+	}
+	if r.Mention && r.Reply == "" {
+		errs = append(errs, errors.New("mention requires reply"))
+	}
+	if r.Image != "" {
+		r.imagePath = r.Image
+		if !filepath.IsAbs(r.imagePath) {
+			r.imagePath = filepath.Join(dir, r.imagePath)
+		}
+		if info, err := os.Stat(r.imagePath); err != nil {
+			errs = append(errs, fmt.Errorf("invalid image: %w", err))
+		} else if info.IsDir() {
+			errs = append(errs, fmt.Errorf("invalid image: %s is a directory", r.imagePath))
+		}
+	}
+	r.senders = make(map[string]empty, len(r.Senders))
+	for _, sender := range r.Senders {
+		r.senders[sender] = empty{}
+	}
+	r.groups = make(map[string]empty, len(r.Groups))
+	for _, group := range r.Groups {
+		r.groups[group] = empty{}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *AutoReplyRule) parseTime() error {
+	from, to, ok := strings.Cut(r.Time, "-")
+	if !ok {
+		return fmt.Errorf("invalid time %q, expected HH:MM-HH:MM", r.Time)
+	}
+	var err error
+	if r.from, err = parseClock(from); err != nil {
+		return fmt.Errorf("invalid time %q: %w", r.Time, err)
+	}
+	if r.to, err = parseClock(to); err != nil {
+		return fmt.Errorf("invalid time %q: %w", r.Time, err)
+	}
+	r.timeWindow = true
+	return nil
+}
+
+// parseClock parses "HH:MM" as the duration since midnight.
+func parseClock(value string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+func (r *AutoReplyRule) inTime(now time.Time) bool {
+	if !r.timeWindow {
+		return true
+	}
+	clock := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	if r.from <= r.to {
+		return clock >= r.from && clock < r.to
+	}
+	// 跨过午夜，如 22:00-06:00
+	return clock >= r.from || clock < r.to
+}
+
+// Match reports whether the message matches the rule.
+func (r *AutoReplyRule) Match(msg *Message, now time.Time) bool {
+	if !msg.IsText() {
+		return false
+	}
+	switch r.Chat {
+	case "group":
+		if !msg.IsGroupMessage() {
+			return false
+		}
+	case "private":
+		if msg.IsGroupMessage() {
+			return false
+		}
+	}
+	if len(r.senders) > 0 {
+		if _, ok := r.senders[msg.SenderID()]; !ok {
+			return false
+		}
+	}
+	if len(r.groups) > 0 {
+		if _, ok := r.groups[msg.FromUser]; !ok || !msg.IsGroupMessage() {
+			return false
+		}
+	}
+	if !r.inTime(now) {
+		return false
+	}
+	text := strings.TrimSpace(msg.Text())
+	if msg.IsGroupMessage() {
+		text = strings.TrimSpace(trimMentions(text))
+	}
+	for _, exact := range r.Exact {
+		if text == exact {
+			return true
+		}
+	}
+	for _, contains := range r.Contains {
+		if strings.Contains(text, contains) {
+			return true
+		}
+	}
+	return r.regex != nil && r.regex.MatchString(text)
+}
+
+// apply runs the actions of the rule on the message.
+func (r *AutoReplyRule) apply(msg *Message) error {
+	var errs []error
+	if r.Forward != "" {
+		if err := msg.ForwardTo(&User{Wxid: r.Forward}); err != nil {
+			errs = append(errs, fmt.Errorf("forward: %w", err))
+		}
+	}
+	if r.Reply != "" {
+		var err error
+		if r.Mention {
+			err = msg.ReplyMention(r.Reply)
+		} else {
+			err = msg.ReplyText(r.Reply)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reply: %w", err))
+		}
+	}
+	if r.imagePath != "" {
+		if err := replyImageFile(msg, r.imagePath); err != nil {
+			errs = append(errs, fmt.Errorf("reply image: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func replyImageFile(msg *Message, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	return msg.ReplyImage(file)
+}
+
+// ParseAutoReplyRules parses the rules from YAML or JSON, dir is the directory the image
+// paths are relative to. All the bad rules are reported as *RuleError joined together.
+func ParseAutoReplyRules(data []byte, dir string) ([]*AutoReplyRule, error) {
+	var file autoReplyFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	// 拼错的字段也要报告出来
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	var errs []error
+	for i, rule := range file.Rules {
+		if rule == nil {
+			errs = append(errs, &RuleError{Index: i, Err: errors.New("empty rule")})
+			continue
+		}
+		if err := rule.compile(dir); err != nil {
+			errs = append(errs, &RuleError{Index: i, Name: rule.Name, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return file.Rules, nil
+}
+
+// LoadAutoReplyRules reads and parses the rule file.
+func LoadAutoReplyRules(path string) ([]*AutoReplyRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAutoReplyRules(data, filepath.Dir(path))
+}
+
+// AutoReply 根据配置文件中的规则自动回复消息，规则按照顺序匹配，默认只执行第一条匹配的规则
+//
+//	rules:
+//	  - name: 问候
+//	    exact: ["你好", "hello"]
+//	    chat: private
+//	    reply: 你好，我是机器人
+//	  - name: 值班
+//	    contains: ["报警"]
+//	    groups: ["123@chatroom"]
+//	    time: "22:00-08:00"
+//	    reply: 已通知值班同学
+//	    mention: true
+type AutoReply struct {
+	path    string
+	mu      sync.RWMutex
+	rules   []*AutoReplyRule
+	modTime time.Time
+}
+
+// Rules returns the rules in use.
+func (a *AutoReply) Rules() []*AutoReplyRule {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.rules
+}
+
+// Reload reads the rule file again, the rules in use are kept if the file is invalid.
+func (a *AutoReply) Reload() error {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+	rules, err := LoadAutoReplyRules(a.path)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rules, a.modTime = rules, info.ModTime()
+	return nil
+}
+
+// Watch reloads the rules when the modification time of the file changes,
+// it checks the file every interval until the context is done.
+func (a *AutoReply) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(a.path)
+		if err != nil {
+			log.Warn().Err(err).Str("path", a.path).Msg("stat auto reply rules")
+			continue
+		}
+		a.mu.RLock()
+		changed := !info.ModTime().Equal(a.modTime)
+		a.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err = a.Reload(); err != nil {
+			log.Error().Err(err).Str("path", a.path).Msg("reload auto reply rules")
+			// 避免对同一个错误的文件反复报错
+			a.mu.Lock()
+			a.modTime = info.ModTime()
+			a.mu.Unlock()
+			continue
+		}
+		log.Info().Str("path", a.path).Int("rules", len(a.Rules())).Msg("auto reply rules reloaded")
+	}
+}
+
+// Dispatch applies the first matched rule, and the following ones if it continues.
+// It reports whether any rule matched.
+func (a *AutoReply) Dispatch(msg *Message) bool {
+	now := time.Now()
+	matched := false
+	for _, rule := range a.Rules() {
+		if !rule.Match(msg, now) {
+			continue
+		}
+		matched = true
+		if err := rule.apply(msg); err != nil {
+			log.Error().Err(err).Str("rule", rule.Name).Msg("apply auto reply rule")
+		}
+		if !rule.Continue {
+			break
+		}
+	}
+	return matched
+}
+
+// ServeMessage implements MessageHandler.
+func (a *AutoReply) ServeMessage(msg *Message) {
+	a.Dispatch(msg)
+}
+
+// Handler returns a router middleware which stops the propagation if any rule matched.
+func (a *AutoReply) Handler() HandlerFunc {
+	return func(ctx *MessageContext) {
+		if a.Dispatch(ctx.Message) {
+			ctx.StopPropagation()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// Command returns a command that checks the rule file with "rules check",
+// and reloads it with "rules reload".
+// Only the senders allowed by permission can run it, nobody if permission is nil,
+// use AllowSenders to allow the administrators.
+func (a *AutoReply) Command(permission func(sender string) bool) *Command {
+	if permission == nil {
+		permission = func(string) bool { return false }
+	}
+	return &Command{
+		Name:        "rules",
+		Description: "检查或者重新加载自动回复规则",
+		Usage:       "[check|reload]",
+		Args:        []Arg{{Name: "action"}},
+		Permission:  permission,
+		Handler: func(ctx *CommandContext) error {
+			switch action := ctx.String("action"); action {
+			case "", "check":
+				rules, err := LoadAutoReplyRules(a.path)
+				if err != nil {
+					return ctx.ReplyText("规则有误:\n" + err.Error())
+				}
+				return ctx.ReplyText(fmt.Sprintf("规则全部有效，共 %d 条", len(rules)))
+			case "reload":
+				if err := a.Reload(); err != nil {
+					return ctx.ReplyText("重新加载失败，继续使用原来的规则:\n" + err.Error())
+				}
+				return ctx.ReplyText(fmt.Sprintf("已重新加载 %d 条规则", len(a.Rules())))
+			default:
+				return ctx.ReplyText("未知的操作 " + action + "，可选 check 或者 reload")
+			}
+		},
+	}
+}
+
+// NewAutoReply loads the rules from the YAML or JSON file at path.
+func NewAutoReply(path string) (*AutoReply, error) {
+	autoReply := &AutoReply{path: path}
+	if err := autoReply.Reload(); err != nil {
+		return nil, err
+	}
+	return autoReply, nil
+}
@@ -0,0 +1,119 @@
+package wxhelper
+
+import (
+	"context"
+	"errors"
+	"github.com/eatmoreapple/wxhelper/wxtest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAutoReplyRules(t *testing.T) {
+	rules, err := ParseAutoReplyRules([]byte(`
+rules:
+  - name: greet
+    exact: ["你好"]
+    chat: private
+    reply: 你好呀
+  - name: alarm
+    regex: "^报警\\d+$"
+    groups: ["123@chatroom"]
+    time: "22:00-08:00"
+    reply: 收到
+    mention: true
+`), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	night := time.Date(2024, 1, 1, 23, 0, 0, 0, time.Local)
+	day := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	cases := []struct {
+		rule  int
+		msg   *Message
+		now   time.Time
+		match bool
+	}{
+		{0, &Message{Type: 1, FromUser: "wxid_a", Content: " 你好 "}, day, true},
+		{0, &Message{Type: 1, FromUser: "123@chatroom", Content: "wxid_a:\n你好"}, day, false},
+		{0, &Message{Type: 3, FromUser: "wxid_a", Content: "你好"}, day, false},
+		{1, &Message{Type: 1, FromUser: "123@chatroom", Content: "wxid_a:\n@机器人\u2005报警42"}, night, true},
+		{1, &Message{Type: 1, FromUser: "123@chatroom", Content: "wxid_a:\n报警42"}, day, false},
+		{1, &Message{Type: 1, FromUser: "456@chatroom", Content: "wxid_a:\n报警42"}, night, false},
+	}
+	for i, c := range cases {
+		if match := rules[c.rule].Match(c.msg, c.now); match != c.match {
+			t.Fatalf("case %d: expected %v, got %v", i, c.match, match)
+		}
+	}
+}
+
+func TestParseAutoReplyRulesError(t *testing.T) {
+	_, err := ParseAutoReplyRules([]byte(`{"rules": [
+		{"name": "ok", "contains": ["hi"], "reply": "hello"},
+		{"name": "bad", "regex": "(", "chat": "channel", "time": "9-18"},
+		{"exact": ["hi"], "image": "missing.png"}
+	]}`), t.TempDir())
+	var ruleErr *RuleError
+	if !errors.As(err, &ruleErr) {
+		t.Fatalf("expected *RuleError, got %v", err)
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 bad rules, got %q", lines)
+	}
+	for _, want := range []string{"rule 2 (bad)", "invalid regex", "invalid chat", "invalid time", "no reply"} {
+		if !strings.Contains(lines[0], want) {
+			t.Fatalf("expected %q in %q", want, lines[0])
+		}
+	}
+	if !strings.HasPrefix(lines[1], "rule 3: invalid image") {
+		t.Fatalf("unexpected error %q", lines[1])
+	}
+
+	if _, err = ParseAutoReplyRules([]byte("rules:\n  - name: typo\n    exacts: [hi]\n"), "."); err == nil {
+		t.Fatal("expected error of the unknown field")
+	}
+}
+
+func TestAutoReplyCommandPermission(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte("rules:\n  - exact: [\"你好\"]\n    reply: 你好呀\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	autoReply, err := NewAutoReply(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot"})
+	bot := New(stack.URL)
+	commander := NewCommander("/")
+	commander.Register(autoReply.Command(AllowSenders("wxid_admin")))
+	bot.MessageHandler = commander.ServeMessage
+	t.Cleanup(bot.Stop)
+	go func() { _ = bot.Run() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// 只有管理员可以重新加载规则
+	if err = stack.InjectText("wxid_a", "/rules reload"); err != nil {
+		t.Fatal(err)
+	}
+	if sent, err := stack.WaitSent(ctx, 1); err != nil || sent[0].Content != "权限不足" {
+		t.Fatalf("expected permission denied, got %v %v", sent, err)
+	}
+	if err = stack.InjectText("wxid_admin", "/rules reload"); err != nil {
+		t.Fatal(err)
+	}
+	if sent, err := stack.WaitSent(ctx, 2); err != nil || sent[1].Content != "已重新加载 1 条规则" {
+		t.Fatalf("expected reloaded, got %v %v", sent, err)
+	}
+
+	// 没有指定权限时拒绝所有人
+	command := autoReply.Command(nil)
+	if command.Permission("wxid_admin") {
+		t.Fatal("expected nil permission to deny everyone")
+	}
+}
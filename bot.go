@@ -2,18 +2,71 @@ package wxhelper
 
 import (
 	"context"
+	"errors"
 	"github.com/eatmoreapple/wxhelper/apiclient"
+	"github.com/eatmoreapple/wxhelper/pkg/dedup"
+	"github.com/rs/zerolog/log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 )
 
+// ErrBotStopped is returned by Bot.Run after Bot.Stop or Bot.Shutdown is called.
+var ErrBotStopped = errors.New("bot stopped")
+
 type Bot struct {
 	MessageHandler MessageHandler
-	client         *Client
-	ctx            context.Context
-	stop           func()
+	// Dispatcher 调度 MessageHandler 的执行，默认每条消息一个 goroutine
+	Dispatcher Dispatcher
+	// Reconnect 消息同步失败后的重连策略，为 nil 时不重连，Run 直接返回错误
+	Reconnect *ReconnectPolicy
+	// OnDisconnect 消息同步失败、开始重连时调用
+	OnDisconnect func(err error)
+	// OnReconnect 重连成功后以新的登录账号调用
+	OnReconnect func(account *Account)
+	// OnLogin 开始同步消息时以登录账号调用，重连后账号发生变化时会再次调用
+	OnLogin func(account *Account)
+	// OnLogout 账号退出登录导致 Bot 停止时调用
+	OnLogout func(err error)
+	// OnError 每次消息同步被错误中断时调用，主动停止 Bot 不会调用
+	OnError func(err error)
+	// OnPanic 处理函数 panic 时以 recover 的值和调用栈调用，为 nil 时只记录日志。
+	// MembershipEventHandlers panic 时 msg 为 nil
+	OnPanic func(msg *Message, recovered any, stack []byte)
+	// OnMessageDropped ConversationDispatcher 丢弃消息时调用
+	OnMessageDropped func(msg *Message)
+	// MessageStore 不为 nil 时记录同步到的消息和发送的消息
+	MessageStore MessageStore
+	// Deduplicator 不为 nil 时过滤重复同步到的消息，例如 APIServer 重启后重新投递的消息
+	Deduplicator *dedup.Deduplicator
+	// Recorder 不为 nil 时录制同步到的原始消息
+	Recorder *MessageRecorder
+	// RateLimiter 不为 nil 时限制所有发送消息的频率
+	RateLimiter *RateLimiter
+	// SystemEventHandlers 处理撤回、入群、拍一拍等系统消息事件
+	SystemEventHandlers
+	// MembershipEventHandlers 处理 MemberWatcher 发现的群成员变化
+	MembershipEventHandlers
+
+	client   *Client
+	contacts *ContactStore
+	ctx      context.Context
+	stop     context.CancelCauseFunc
+	// syncCtx 控制消息轮询，停止轮询后 ctx 仍然可用，正在执行的 MessageHandler 依然可以回复消息
+	syncCtx  context.Context
+	stopSync context.CancelCauseFunc
+	sessions sessionManager
+	running  atomic.Bool
+	done     chan struct{}
+	finish   sync.Once
+	err      error
 }
 
 func (b *Bot) Context() context.Context { return b.ctx }
 
+// Contacts returns the cached contact list of the bot.
+func (b *Bot) Contacts() *ContactStore { return b.contacts }
+
 func (b *Bot) GetLoginAccount() (*Account, error) {
 	account, err := b.client.GetUserInfo(b.ctx)
 	if err != nil {
@@ -23,54 +76,250 @@ func (b *Bot) GetLoginAccount() (*Account, error) {
 	return account, nil
 }
 
-func (b *Bot) syncMessage() error {
+func (b *Bot) syncMessage() (err error) {
+	defer func() { b.notifyStopped(err) }()
 	account, err := b.GetLoginAccount()
 	if err != nil {
-		return err
+		if b.syncCtx.Err() != nil {
+			// 登录期间调用了 Stop 或者 Shutdown
+			return context.Cause(b.syncCtx)
+		}
+		policy := b.Reconnect
+		if policy == nil || !policy.retryable(err) {
+			return err
+		}
+		if b.OnError != nil {
+			b.OnError(err)
+		}
+		// APIServer 可能还没有启动，按照重连策略重试登录
+		if account, err = b.reconnect(policy); err != nil {
+			return err
+		}
+	}
+	if b.OnLogin != nil {
+		b.OnLogin(account)
 	}
+	defer b.sessions.closeAll()
+	for {
+		err = b.pollMessage(account)
+		policy := b.Reconnect
+		if b.syncCtx.Err() != nil || policy == nil || !policy.retryable(err) {
+			return err
+		}
+		if b.OnError != nil {
+			b.OnError(err)
+		}
+		if b.OnDisconnect != nil {
+			b.OnDisconnect(err)
+		}
+		previous := account
+		// 重连之后登录的账号可能已经变化，需要重新获取
+		if account, err = b.reconnect(policy); err != nil {
+			return err
+		}
+		b.contacts.Invalidate()
+		if b.OnLogin != nil && account.Wxid != previous.Wxid {
+			b.OnLogin(account)
+		}
+		if b.OnReconnect != nil {
+			b.OnReconnect(account)
+		}
+	}
+}
+
+// notifyStopped calls the hooks with the error that stops the message sync.
+func (b *Bot) notifyStopped(err error) {
+	if err == nil || errors.Is(err, ErrBotStopped) || b.syncCtx.Err() != nil {
+		return
+	}
+	if b.OnError != nil {
+		b.OnError(err)
+	}
+	if b.OnLogout != nil && IsLogoutError(err) {
+		b.OnLogout(err)
+	}
+}
+
+// IsLogoutError reports whether the error means the account is logged out.
+func IsLogoutError(err error) bool {
+	return errors.Is(err, apiclient.ErrAuth) || errors.Is(err, ErrNotLogin)
+}
+
+// pollMessage polls messages until an error occurs.
+func (b *Bot) pollMessage(account *Account) error {
 	for {
 		select {
-		case <-b.ctx.Done():
-			return b.ctx.Err()
+		case <-b.syncCtx.Done():
+			return context.Cause(b.syncCtx)
 		default:
 		}
-		message, err := b.client.SyncMessage(b.ctx)
+		message, err := b.client.SyncMessage(b.syncCtx)
 		if err != nil {
+			if b.syncCtx.Err() != nil {
+				return context.Cause(b.syncCtx)
+			}
 			return err
 		}
 		for _, msg := range message {
+			b.recordMessage(msg)
+			if b.isDuplicate(msg) {
+				continue
+			}
 			msg.account = account
-			if b.MessageHandler != nil {
-				go b.MessageHandler(msg)
+			b.storeMessage(msg)
+			// 优先交给等待中的会话
+			if b.sessions.deliver(msg) {
+				continue
 			}
+			b.Dispatcher.Dispatch(msg, b.serveMessage)
+		}
+	}
+}
+
+// isDuplicate reports whether the message has been synced before.
+func (b *Bot) isDuplicate(msg *Message) bool {
+	if b.Deduplicator == nil {
+		return false
+	}
+	duplicate, err := b.Deduplicator.Duplicate(b.ctx, msg.MsgId, msg.MsgSequence)
+	if err != nil {
+		log.Error().Err(err).Int64("msgId", msg.MsgId).Msg("deduplicate message")
+		return false
+	}
+	return duplicate
+}
+
+// storeMessage appends the message to the MessageStore if set.
+func (b *Bot) storeMessage(msg *Message) {
+	if b.MessageStore == nil {
+		return
+	}
+	if err := b.MessageStore.Append(b.ctx, msg); err != nil {
+		log.Error().Err(err).Int64("msgId", msg.MsgId).Msg("store message")
+	}
+}
+
+// waitSend waits for the RateLimiter before sending to the recipient.
+func (b *Bot) waitSend(to string) error {
+	if b.RateLimiter == nil {
+		return nil
+	}
+	return b.RateLimiter.Wait(b.ctx, to)
+}
+
+func (b *Bot) serveMessage(msg *Message) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			b.handlePanic(msg, recovered, debug.Stack())
 		}
+	}()
+	if msg.IsSystemMessage() {
+		if event, err := ParseSystemEvent(msg); err == nil {
+			b.serveSystemEvent(event)
+		}
+	}
+	if b.MessageHandler != nil {
+		b.MessageHandler(msg)
 	}
 }
 
+func (b *Bot) handlePanic(msg *Message, recovered any, stack []byte) {
+	if b.OnPanic != nil {
+		b.OnPanic(msg, recovered, stack)
+		return
+	}
+	event := log.Error().Interface("panic", recovered)
+	if msg != nil {
+		event = event.Int64("msgId", msg.MsgId)
+	}
+	event.Bytes("stack", stack).Msg("message handler panic")
+}
+
+// watchDropped reports the messages dropped by the dispatcher to OnMessageDropped.
+func (b *Bot) watchDropped() {
+	dispatcher, ok := b.Dispatcher.(*ConversationDispatcher)
+	if !ok {
+		return
+	}
+	onDrop := dispatcher.OnDrop
+	dispatcher.OnDrop = func(msg *Message) {
+		if onDrop != nil {
+			onDrop(msg)
+		}
+		if b.OnMessageDropped != nil {
+			b.OnMessageDropped(msg)
+		}
+	}
+}
+
+// Run starts polling messages and blocks until the bot stops.
+// It always returns a non-nil error, ErrBotStopped after Stop or Shutdown.
+// Run should be called only once.
 func (b *Bot) Run() error {
-	return b.syncMessage()
-	//messageChan, err := b.messageRetriever.RetrieveMessage()
-	//if err != nil {
-	//	return err
-	//}
-	//for {
-	//	select {
-	//	case <-b.ctx.Done():
-	//		return b.Stop()
-	//	case msg := <-messageChan:
-	//		if b.MessageHandler != nil {
-	//			go b.MessageHandler(msg)
-	//		}
-	//	}
-	//}
+	if b.Dispatcher == nil {
+		b.Dispatcher = &UnboundedDispatcher{}
+	}
+	b.watchDropped()
+	b.running.Store(true)
+	err := b.syncMessage()
+	b.finish.Do(func() {
+		b.err = err
+		close(b.done)
+	})
+	return err
+}
+
+// Stop stops the bot immediately, the context of in-flight handlers is canceled.
+func (b *Bot) Stop() {
+	b.stop(ErrBotStopped)
+}
+
+// Shutdown stops polling messages and waits for in-flight handlers to finish.
+// If ctx expires before all handlers finish, Shutdown returns the context's error,
+// otherwise it returns nil. The bot's context is canceled when Shutdown returns.
+func (b *Bot) Shutdown(ctx context.Context) error {
+	b.stopSync(ErrBotStopped)
+	defer b.stop(ErrBotStopped)
+	// wait for the polling loop, no more handlers will be started after it returns
+	if b.running.Load() {
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if b.Dispatcher == nil {
+		return nil
+	}
+	return b.Dispatcher.Shutdown(ctx)
+}
+
+// Done returns a channel that's closed when Run returns.
+func (b *Bot) Done() <-chan struct{} {
+	return b.done
+}
+
+// Err returns the error Run returned, or nil if Run has not returned yet.
+func (b *Bot) Err() error {
+	select {
+	case <-b.done:
+		return b.err
+	default:
+		return nil
+	}
 }
 
 func New(apiServerURL string) *Bot {
+	client := &Client{
+		apiclient: apiclient.New(apiServerURL),
+	}
 	bot := &Bot{
-		client: &Client{
-			apiclient: apiclient.New(apiServerURL),
-		},
+		client:     client,
+		contacts:   newContactStore(client),
+		Dispatcher: &UnboundedDispatcher{},
+		done:       make(chan struct{}),
 	}
-	bot.ctx, bot.stop = context.WithCancel(context.Background())
+	bot.ctx, bot.stop = context.WithCancelCause(context.Background())
+	bot.syncCtx, bot.stopSync = context.WithCancelCause(bot.ctx)
 	return bot
 }
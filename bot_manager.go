@@ -0,0 +1,279 @@
+package wxhelper
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/sync/errgroup"
+	"sync"
+	"time"
+)
+
+// BotStatus 是 BotManager 中一个 Bot 的运行状态
+type BotStatus struct {
+	// APIServerURL is the apiserver the bot connects to.
+	APIServerURL string
+	// Account is the login account, nil if the bot is not logged in.
+	Account *Account
+	// Running reports whether the bot is syncing messages.
+	Running bool
+	// Restarts is the number of restarts since the manager started.
+	Restarts int
+	// LastMessageAt is the time the last message was handled.
+	LastMessageAt time.Time
+	// LastError is the error the bot stopped with last time.
+	LastError error
+}
+
+// LoggedIn reports whether the bot is logged in.
+func (s BotStatus) LoggedIn() bool { return s.Account != nil }
+
+type managedBot struct {
+	url string
+
+	mu            sync.Mutex
+	bot           *Bot
+	account       *Account
+	running       bool
+	restarts      int
+	lastMessageAt time.Time
+	lastErr       error
+}
+
+func (mb *managedBot) status() BotStatus {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return BotStatus{
+		APIServerURL:  mb.url,
+		Account:       mb.account,
+		Running:       mb.running,
+		Restarts:      mb.restarts,
+		LastMessageAt: mb.lastMessageAt,
+		LastError:     mb.lastErr,
+	}
+}
+
+func (mb *managedBot) setAccount(account *Account) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.account = account
+}
+
+func (mb *managedBot) touch() {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.lastMessageAt = time.Now()
+}
+
+// BotManager 在同一个进程中运行多个 Bot，每个 Bot 连接一个 apiserver。
+// 所有的 Bot 共享同一个 MessageHandler，通过 Message.Owner 区分收到消息的账号，
+// Bot 异常退出后按照 Restart 策略重新启动。
+type BotManager struct {
+	// MessageHandler handles the messages of all the bots.
+	MessageHandler MessageHandler
+	// Configure is called with every new bot before it runs, including the restarted ones.
+	// A MessageHandler set here takes the place of the shared one.
+	Configure func(bot *Bot)
+	// Restart is the backoff between restarts, DefaultReconnectPolicy is used if it is nil.
+	// Its Retryable decides whether to restart, every error is restarted if it is nil.
+	// Its MaxAttempts limits the restarts in a row without login.
+	Restart *ReconnectPolicy
+
+	bots     []*managedBot
+	ctx      context.Context
+	stop     context.CancelCauseFunc
+	starting sync.Once
+	wg       sync.WaitGroup
+	errMu    sync.Mutex
+	errs     []error
+}
+
+func (m *BotManager) restartPolicy() *ReconnectPolicy {
+	if m.Restart == nil {
+		return DefaultReconnectPolicy()
+	}
+	return m.Restart
+}
+
+// newBot creates a bot for the managed bot and hooks its status.
+func (m *BotManager) newBot(mb *managedBot, loggedIn *bool) *Bot {
+	bot := New(mb.url)
+	if m.Configure != nil {
+		m.Configure(bot)
+	}
+	onLogin, onReconnect, onLogout := bot.OnLogin, bot.OnReconnect, bot.OnLogout
+	bot.OnLogin = func(account *Account) {
+		*loggedIn = true
+		mb.setAccount(account)
+		if onLogin != nil {
+			onLogin(account)
+		}
+	}
+	bot.OnReconnect = func(account *Account) {
+		mb.setAccount(account)
+		if onReconnect != nil {
+			onReconnect(account)
+		}
+	}
+	bot.OnLogout = func(err error) {
+		mb.setAccount(nil)
+		if onLogout != nil {
+			onLogout(err)
+		}
+	}
+	handler := bot.MessageHandler
+	if handler == nil {
+		handler = m.MessageHandler
+	}
+	bot.MessageHandler = func(msg *Message) {
+		mb.touch()
+		if handler != nil {
+			handler(msg)
+		}
+	}
+	return bot
+}
+
+// supervise runs the bot and restarts it until the manager stops or the policy gives up.
+func (m *BotManager) supervise(mb *managedBot) error {
+	policy := m.restartPolicy()
+	attempt := 0
+	for {
+		var loggedIn bool
+		bot := m.newBot(mb, &loggedIn)
+		mb.mu.Lock()
+		// Stop 在创建 Bot 之前调用
+		if m.ctx.Err() != nil {
+			mb.mu.Unlock()
+			return nil
+		}
+		mb.bot, mb.running = bot, true
+		mb.mu.Unlock()
+
+		err := bot.Run()
+
+		mb.mu.Lock()
+		mb.running, mb.account, mb.lastErr = false, nil, err
+		mb.mu.Unlock()
+
+		if m.ctx.Err() != nil {
+			return nil
+		}
+		if policy.Retryable != nil && !policy.Retryable(err) {
+			return err
+		}
+		if loggedIn {
+			attempt = 0
+		}
+		attempt++
+		if policy.MaxAttempts > 0 && attempt > policy.MaxAttempts {
+			return err
+		}
+		timer := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-m.ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		mb.mu.Lock()
+		mb.restarts++
+		mb.mu.Unlock()
+	}
+}
+
+// Start starts all the bots in the background.
+func (m *BotManager) Start() {
+	m.starting.Do(func() {
+		for _, mb := range m.bots {
+			mb := mb
+			m.wg.Add(1)
+			go func() {
+				defer m.wg.Done()
+				if err := m.supervise(mb); err != nil {
+					m.errMu.Lock()
+					m.errs = append(m.errs, err)
+					m.errMu.Unlock()
+				}
+			}()
+		}
+	})
+}
+
+// Run starts all the bots and blocks until all of them stop.
+// It returns ErrBotStopped after Stop or Shutdown, otherwise the errors the bots gave up with.
+func (m *BotManager) Run() error {
+	m.Start()
+	m.wg.Wait()
+	if m.ctx.Err() != nil {
+		return ErrBotStopped
+	}
+	m.errMu.Lock()
+	defer m.errMu.Unlock()
+	return errors.Join(m.errs...)
+}
+
+// Stop stops all the bots immediately.
+func (m *BotManager) Stop() {
+	m.stop(ErrBotStopped)
+	for _, mb := range m.bots {
+		mb.mu.Lock()
+		if mb.bot != nil {
+			mb.bot.Stop()
+		}
+		mb.mu.Unlock()
+	}
+}
+
+// Shutdown stops all the bots gracefully, see Bot.Shutdown.
+func (m *BotManager) Shutdown(ctx context.Context) error {
+	m.stop(ErrBotStopped)
+	var group errgroup.Group
+	for _, mb := range m.bots {
+		mb.mu.Lock()
+		bot := mb.bot
+		mb.mu.Unlock()
+		if bot == nil {
+			continue
+		}
+		group.Go(func() error { return bot.Shutdown(ctx) })
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	return waitContext(ctx, m.wg.Wait)
+}
+
+// Status returns the status of all the bots in the order of the apiserver urls.
+func (m *BotManager) Status() []BotStatus {
+	statuses := make([]BotStatus, 0, len(m.bots))
+	for _, mb := range m.bots {
+		statuses = append(statuses, mb.status())
+	}
+	return statuses
+}
+
+// Bot returns the running bot of the apiserver url, nil if it is not running.
+func (m *BotManager) Bot(apiServerURL string) *Bot {
+	for _, mb := range m.bots {
+		if mb.url != apiServerURL {
+			continue
+		}
+		mb.mu.Lock()
+		defer mb.mu.Unlock()
+		if !mb.running {
+			return nil
+		}
+		return mb.bot
+	}
+	return nil
+}
+
+// NewBotManager returns a BotManager that runs a bot for each apiserver url.
+func NewBotManager(apiServerURLs ...string) *BotManager {
+	manager := &BotManager{}
+	for _, url := range apiServerURLs {
+		manager.bots = append(manager.bots, &managedBot{url: url})
+	}
+	manager.ctx, manager.stop = context.WithCancelCause(context.Background())
+	return manager
+}
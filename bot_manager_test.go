@@ -0,0 +1,54 @@
+package wxhelper
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBotManagerRestart(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	manager := NewBotManager(server.URL)
+	manager.Restart = &ReconnectPolicy{InitialInterval: time.Millisecond, MaxAttempts: 3}
+	var configured int
+	manager.Configure = func(bot *Bot) { configured++ }
+
+	err := manager.Run()
+	if err == nil || errors.Is(err, ErrBotStopped) {
+		t.Fatalf("expected the bot to give up, got %v", err)
+	}
+	if configured != 4 {
+		t.Fatalf("expected 4 bots, got %d", configured)
+	}
+	status := manager.Status()
+	if len(status) != 1 || status[0].Restarts != 3 || status[0].Running || status[0].LoggedIn() {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if status[0].LastError == nil {
+		t.Fatal("expected the last error")
+	}
+}
+
+func TestBotManagerStop(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	manager := NewBotManager(server.URL, server.URL)
+	manager.Restart = &ReconnectPolicy{InitialInterval: time.Hour}
+	done := make(chan error, 1)
+	go func() { done <- manager.Run() }()
+	time.Sleep(50 * time.Millisecond)
+	manager.Stop()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrBotStopped) {
+			t.Fatalf("expected %v, got %v", ErrBotStopped, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("manager did not stop")
+	}
+}
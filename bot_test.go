@@ -0,0 +1,157 @@
+package wxhelper
+
+import (
+	"context"
+	"errors"
+	"github.com/eatmoreapple/wxhelper/wxtest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot"})
+	started := make(chan struct{}, 1)
+	bot := New(stack.URL)
+	bot.MessageHandler = func(msg *Message) {
+		started <- struct{}{}
+		time.Sleep(100 * time.Millisecond)
+		// Shutdown 等待期间依然可以回复
+		_ = msg.ReplyText("done")
+	}
+	go func() { _ = bot.Run() }()
+	if err := stack.InjectText("wxid_a", "slow"); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := bot.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if sent := stack.Sent(); len(sent) != 1 || sent[0].Content != "done" {
+		t.Fatalf("expected the in-flight handler to reply, got %+v", sent)
+	}
+	if !errors.Is(bot.Err(), ErrBotStopped) {
+		t.Fatalf("expected %v, got %v", ErrBotStopped, bot.Err())
+	}
+	if bot.Context().Err() == nil {
+		t.Fatal("expected the bot context to be canceled")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot"})
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	bot := New(stack.URL)
+	bot.MessageHandler = func(msg *Message) {
+		started <- struct{}{}
+		<-release
+	}
+	go func() { _ = bot.Run() }()
+	if err := stack.InjectText("wxid_a", "stuck"); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	// 超时之后不再等待，Bot 的 context 被取消
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := bot.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if bot.Context().Err() == nil {
+		t.Fatal("expected the bot context to be canceled")
+	}
+	select {
+	case <-bot.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+}
+
+func TestBotHooks(t *testing.T) {
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot"})
+	var (
+		mu    sync.Mutex
+		calls = make(map[string]int)
+	)
+	called := func(hook string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[hook]++
+	}
+	release := make(chan struct{})
+	blocked := make(chan struct{})
+	bot := New(stack.URL)
+	// 一次只处理一条消息，队列满了之后丢弃新的消息
+	bot.Dispatcher = &ConversationDispatcher{MaxConcurrency: 1, QueueSize: 1, Overflow: OverflowDropNewest}
+	bot.MessageHandler = func(msg *Message) {
+		switch msg.Text() {
+		case "panic":
+			panic("boom")
+		case "block":
+			close(blocked)
+			<-release
+		}
+	}
+	bot.OnLogin = func(account *Account) { called("login") }
+	bot.OnLogout = func(err error) { called("logout") }
+	bot.OnError = func(err error) { called("error") }
+	bot.OnPanic = func(msg *Message, recovered any, stack []byte) {
+		if recovered == "boom" && msg.Text() == "panic" {
+			called("panic")
+		}
+	}
+	bot.OnMessageDropped = func(msg *Message) {
+		if msg.Text() == "dropped" {
+			called("dropped")
+		}
+	}
+	done := make(chan error, 1)
+	go func() { done <- bot.Run() }()
+
+	for _, text := range []string{"panic", "block"} {
+		if err := stack.InjectText("wxid_a", text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-blocked
+	for _, text := range []string{"queued", "dropped"} {
+		if err := stack.InjectText("wxid_a", text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := calls["dropped"]
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the message is not dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+
+	// 退出登录之后 Bot 停止
+	stack.Logout()
+	select {
+	case err := <-done:
+		if !IsLogoutError(err) {
+			t.Fatalf("expected a logout error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the bot did not stop after logout")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, hook := range []string{"login", "logout", "error", "panic", "dropped"} {
+		if calls[hook] != 1 {
+			t.Fatalf("expected %s to be called once, got %d", hook, calls[hook])
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"github.com/eatmoreapple/wxhelper/apiclient"
+	"github.com/eatmoreapple/wxhelper/apiserver"
 	"github.com/eatmoreapple/wxhelper/pkg/structcopy"
 	"io"
 )
@@ -85,6 +86,14 @@ func (c *Client) InviteMemberToChatRoom(ctx context.Context, chatRoomID string,
 	return c.apiclient.InviteMemberToChatRoom(ctx, chatRoomID, memberIDs)
 }
 
+func (c *Client) DelMemberFromChatRoom(ctx context.Context, chatRoomID string, memberIDs []string) error {
+	return c.apiclient.DelMemberFromChatRoom(ctx, chatRoomID, memberIDs)
+}
+
+func (c *Client) ModifyNickname(ctx context.Context, chatRoomID, wxID, nickname string) error {
+	return c.apiclient.ModifyNickname(ctx, chatRoomID, wxID, nickname)
+}
+
 func (c *Client) ForwardMsg(ctx context.Context, wxID, msgID string) error {
 	return c.apiclient.ForwardMsg(ctx, wxID, msgID)
 }
@@ -92,3 +101,16 @@ func (c *Client) ForwardMsg(ctx context.Context, wxID, msgID string) error {
 func (c *Client) QuitChatRoom(ctx context.Context, chatRoomID string) error {
 	return c.apiclient.QuitChatRoom(ctx, chatRoomID)
 }
+
+func (c *Client) DownloadMedia(ctx context.Context, msg *Message, writer io.Writer) error {
+	return c.apiclient.DownloadMedia(ctx, apiserver.DownloadMediaRequest{
+		MsgID:    msg.MsgId,
+		Type:     msg.Type,
+		FromUser: msg.FromUser,
+		Content:  msg.Content,
+	}, writer)
+}
+
+func (c *Client) SendQuote(ctx context.Context, req apiserver.SendQuoteRequest) error {
+	return c.apiclient.SendQuote(ctx, req)
+}
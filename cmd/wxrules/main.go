@@ -0,0 +1,48 @@
+// wxrules 检查自动回复规则文件，有错误时逐条输出并以状态码 1 退出
+//
+//	wxrules rules.yaml [more.json ...]
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/eatmoreapple/wxhelper"
+	"os"
+)
+
+func main() {
+	flag.Usage = func() {
+		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "usage: wxrules <rule file>...")
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	failed := false
+	for _, path := range flag.Args() {
+		rules, err := wxhelper.LoadAutoReplyRules(path)
+		if err != nil {
+			failed = true
+			report(path, err)
+			continue
+		}
+		fmt.Printf("%s: ok, %d rules\n", path, len(rules))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// report prints every rule error on its own line.
+func report(path string, err error) {
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return
+	}
+	for _, err = range joined.Unwrap() {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+	}
+}
@@ -0,0 +1,521 @@
+package wxhelper
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrPermissionDenied is returned when the sender is not allowed to run the command.
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// ArgType 参数类型
+type ArgType int
+
+const (
+	ArgString ArgType = iota
+	ArgInt
+	ArgFloat
+	ArgBool
+)
+
+func (t ArgType) String() string {
+	switch t {
+	case ArgInt:
+		return "int"
+	case ArgFloat:
+		return "float"
+	case ArgBool:
+		return "bool"
+	default:
+		return "string"
+	}
+}
+
+func (t ArgType) parse(value string) (any, error) {
+	switch t {
+	case ArgInt:
+		return strconv.Atoi(value)
+	case ArgFloat:
+		return strconv.ParseFloat(value, 64)
+	case ArgBool:
+		return strconv.ParseBool(value)
+	default:
+		return value, nil
+	}
+}
+
+func (t ArgType) zero() any {
+	switch t {
+	case ArgInt:
+		return 0
+	case ArgFloat:
+		return float64(0)
+	case ArgBool:
+		return false
+	default:
+		return ""
+	}
+}
+
+// Arg 位置参数
+type Arg struct {
+	Name     string
+	Type     ArgType
+	Required bool
+	// Variadic takes the rest of the positional arguments as one string.
+	// It must be the last argument and its type is always ArgString.
+	Variadic bool
+}
+
+// Flag 选项参数，形如 --name=value、--name value 或者 -n value
+type Flag struct {
+	Name  string
+	Short string
+	Type  ArgType
+	// Default is used when the flag is not given, it must match the Type.
+	Default any
+	Usage   string
+}
+
+// Command 一条命令的声明
+type Command struct {
+	Name        string
+	Aliases     []string
+	Description string
+	// Usage overrides the generated usage string, without the command name.
+	Usage string
+	Args  []Arg
+	Flags []Flag
+	// Permission reports whether the sender is allowed to run the command.
+	// Everyone is allowed if it is nil.
+	Permission func(sender string) bool
+	Handler    func(ctx *CommandContext) error
+}
+
+func (c *Command) usage(prefix string) string {
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	sb.WriteString(c.Name)
+	if c.Usage != "" {
+		sb.WriteString(" ")
+		sb.WriteString(c.Usage)
+		return sb.String()
+	}
+	for _, arg := range c.Args {
+		switch {
+		case arg.Variadic:
+			sb.WriteString(" <" + arg.Name + "...>")
+		case arg.Required:
+			sb.WriteString(" <" + arg.Name + ">")
+		default:
+			sb.WriteString(" [" + arg.Name + "]")
+		}
+	}
+	for _, flag := range c.Flags {
+		if flag.Type == ArgBool {
+			sb.WriteString(" [--" + flag.Name + "]")
+		} else {
+			sb.WriteString(" [--" + flag.Name + "=" + flag.Type.String() + "]")
+		}
+	}
+	return sb.String()
+}
+
+func (c *Command) lookupFlag(name string, short bool) (*Flag, bool) {
+	for i := range c.Flags {
+		if (!short && c.Flags[i].Name == name) || (short && c.Flags[i].Short != "" && c.Flags[i].Short == name) {
+			return &c.Flags[i], true
+		}
+	}
+	return nil, false
+}
+
+// parse parses the tokens after the command name into named values.
+func (c *Command) parse(tokens []string) (map[string]any, error) {
+	values := make(map[string]any, len(c.Args)+len(c.Flags))
+	for _, flag := range c.Flags {
+		if flag.Default != nil {
+			values[flag.Name] = flag.Default
+		} else {
+			values[flag.Name] = flag.Type.zero()
+		}
+	}
+	var positional []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token == "--" {
+			positional = append(positional, tokens[i+1:]...)
+			break
+		}
+		var (
+			flag *Flag
+			ok   bool
+		)
+		name, value, hasValue := strings.Cut(strings.TrimLeft(token, "-"), "=")
+		switch {
+		case strings.HasPrefix(token, "--") && len(token) > 2:
+			if flag, ok = c.lookupFlag(name, false); !ok {
+				return nil, fmt.Errorf("unknown flag: %s", token)
+			}
+		case strings.HasPrefix(token, "-") && len(token) > 1:
+			// maybe a negative number
+			if flag, ok = c.lookupFlag(name, true); !ok {
+				positional = append(positional, token)
+				continue
+			}
+		default:
+			positional = append(positional, token)
+			continue
+		}
+		if !hasValue {
+			if flag.Type == ArgBool {
+				value = "true"
+			} else if i+1 < len(tokens) {
+				i++
+				value = tokens[i]
+			} else {
+				return nil, fmt.Errorf("flag --%s requires a value", flag.Name)
+			}
+		}
+		parsed, err := flag.Type.parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for flag --%s: want %s", value, flag.Name, flag.Type)
+		}
+		values[flag.Name] = parsed
+	}
+	for i, arg := range c.Args {
+		if arg.Variadic {
+			if i < len(positional) {
+				values[arg.Name] = strings.Join(positional[i:], " ")
+				positional = positional[:i]
+			} else if arg.Required {
+				return nil, fmt.Errorf("missing argument: %s", arg.Name)
+			} else {
+				values[arg.Name] = ""
+			}
+			break
+		}
+		if i >= len(positional) {
+			if arg.Required {
+				return nil, fmt.Errorf("missing argument: %s", arg.Name)
+			}
+			values[arg.Name] = arg.Type.zero()
+			continue
+		}
+		parsed, err := arg.Type.parse(positional[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for argument %s: want %s", positional[i], arg.Name, arg.Type)
+		}
+		values[arg.Name] = parsed
+	}
+	if len(positional) > len(c.Args) {
+		return nil, fmt.Errorf("too many arguments: %s", strings.Join(positional[len(c.Args):], " "))
+	}
+	return values, nil
+}
+
+// UsageError 表示命令参数不合法
+type UsageError struct {
+	Usage string
+	Err   error
+}
+
+func (e *UsageError) Error() string { return e.Err.Error() }
+
+func (e *UsageError) Unwrap() error { return e.Err }
+
+// CommandContext 命令执行的上下文
+type CommandContext struct {
+	*Message
+	Command *Command
+	// Name is the name or alias the command was called with.
+	Name   string
+	values map[string]any
+}
+
+// Value returns the parsed value of the argument or flag.
+func (c *CommandContext) Value(name string) any {
+	return c.values[name]
+}
+
+func (c *CommandContext) String(name string) string {
+	value, _ := c.values[name].(string)
+	return value
+}
+
+func (c *CommandContext) Int(name string) int {
+	value, _ := c.values[name].(int)
+	return value
+}
+
+func (c *CommandContext) Float(name string) float64 {
+	value, _ := c.values[name].(float64)
+	return value
+}
+
+func (c *CommandContext) Bool(name string) bool {
+	value, _ := c.values[name].(bool)
+	return value
+}
+
+// Commander 解析并执行斜杠风格的命令，如 "/weather beijing --days=3"
+//
+//	commander := wxhelper.NewCommander()
+//	commander.Register(&wxhelper.Command{
+//		Name: "weather",
+//		Args: []wxhelper.Arg{{Name: "city", Required: true}},
+//		Handler: func(ctx *wxhelper.CommandContext) error {
+//			return ctx.ReplyText(ctx.String("city") + ": 晴")
+//		},
+//	})
+//	bot.MessageHandler = commander.ServeMessage
+type Commander struct {
+	// Prefixes are the leading characters of a command, defaults to "/" and "#".
+	Prefixes []string
+	// RequireAtMe only accepts group commands which mention the current account.
+	RequireAtMe bool
+	// ErrorHandler handles errors of parsing, permission checking and command handlers.
+	// By default, usage errors are replied with the usage and others are logged.
+	ErrorHandler func(ctx *CommandContext, err error)
+
+	commands map[string]*Command
+	ordered  []*Command
+}
+
+// Register registers commands. It panics if a name or an alias is already registered.
+func (c *Commander) Register(commands ...*Command) {
+	if c.commands == nil {
+		c.commands = make(map[string]*Command)
+	}
+	for _, command := range commands {
+		if command.Handler == nil {
+			panic("wxhelper: nil handler for command " + command.Name)
+		}
+		for _, name := range append([]string{command.Name}, command.Aliases...) {
+			name = strings.ToLower(name)
+			if _, exists := c.commands[name]; exists {
+				panic("wxhelper: command " + name + " already registered")
+			}
+			c.commands[name] = command
+		}
+		c.ordered = append(c.ordered, command)
+	}
+}
+
+// Help returns the help text of all registered commands.
+func (c *Commander) Help() string {
+	commands := make([]*Command, len(c.ordered))
+	copy(commands, c.ordered)
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	var sb strings.Builder
+	sb.WriteString("可用命令:")
+	for _, command := range commands {
+		sb.WriteString("\n")
+		sb.WriteString(command.usage(c.prefix()))
+		if command.Description != "" {
+			sb.WriteString("  ")
+			sb.WriteString(command.Description)
+		}
+	}
+	return sb.String()
+}
+
+func (c *Commander) prefix() string {
+	if prefixes := c.prefixes(); len(prefixes) > 0 {
+		return prefixes[0]
+	}
+	return ""
+}
+
+func (c *Commander) prefixes() []string {
+	if len(c.Prefixes) == 0 {
+		return []string{"/", "#"}
+	}
+	return c.Prefixes
+}
+
+// Dispatch runs the command in the message and reports whether the message is a known command.
+func (c *Commander) Dispatch(msg *Message) bool {
+	if !msg.IsText() {
+		return false
+	}
+	sender, text := msg.SenderID(), msg.Text()
+	if msg.IsGroupMessage() {
+		if c.RequireAtMe && !msg.IsAtMe() {
+			return false
+		}
+		text = trimMentions(text)
+	}
+	text = strings.TrimSpace(text)
+
+	var name string
+	for _, prefix := range c.prefixes() {
+		if strings.HasPrefix(text, prefix) {
+			name, text = strings.TrimPrefix(text, prefix), ""
+			if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+				name, text = name[:i], name[i:]
+			}
+			break
+		}
+	}
+	if name == "" {
+		return false
+	}
+	command, exists := c.commands[strings.ToLower(name)]
+	if !exists {
+		if strings.EqualFold(name, "help") {
+			c.replyHelp(msg, text)
+			return true
+		}
+		return false
+	}
+
+	ctx := &CommandContext{Message: msg, Command: command, Name: name}
+	if command.Permission != nil && !command.Permission(sender) {
+		c.handleError(ctx, ErrPermissionDenied)
+		return true
+	}
+	tokens, err := tokenize(text)
+	if err == nil {
+		ctx.values, err = command.parse(tokens)
+	}
+	if err != nil {
+		c.handleError(ctx, &UsageError{Usage: command.usage(c.prefix()), Err: err})
+		return true
+	}
+	if err = command.Handler(ctx); err != nil {
+		c.handleError(ctx, err)
+	}
+	return true
+}
+
+// ServeMessage implements MessageHandler.
+func (c *Commander) ServeMessage(msg *Message) {
+	c.Dispatch(msg)
+}
+
+// Handler returns a router middleware which stops the propagation
+// if the message is handled as a command.
+func (c *Commander) Handler() HandlerFunc {
+	return func(ctx *MessageContext) {
+		if c.Dispatch(ctx.Message) {
+			ctx.StopPropagation()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func (c *Commander) replyHelp(msg *Message, args string) {
+	help := c.Help()
+	if name := strings.TrimSpace(args); name != "" {
+		if command, exists := c.commands[strings.ToLower(name)]; exists {
+			help = "用法: " + command.usage(c.prefix())
+			if command.Description != "" {
+				help += "\n" + command.Description
+			}
+		}
+	}
+	if err := msg.ReplyText(help); err != nil {
+		log.Error().Err(err).Msg("reply command help")
+	}
+}
+
+func (c *Commander) handleError(ctx *CommandContext, err error) {
+	if c.ErrorHandler != nil {
+		c.ErrorHandler(ctx, err)
+		return
+	}
+	var (
+		usageErr *UsageError
+		reply    string
+	)
+	switch {
+	case errors.As(err, &usageErr):
+		reply = "参数错误: " + usageErr.Error() + "\n用法: " + usageErr.Usage
+	case errors.Is(err, ErrPermissionDenied):
+		reply = "权限不足"
+	default:
+		log.Error().Err(err).Str("command", ctx.Command.Name).Msg("run command")
+		return
+	}
+	if err = ctx.ReplyText(reply); err != nil {
+		log.Error().Err(err).Msg("reply command error")
+	}
+}
+
+func NewCommander(prefixes ...string) *Commander {
+	return &Commander{Prefixes: prefixes}
+}
+
+// AllowSenders returns a Command.Permission which only allows the given wxids.
+func AllowSenders(wxIDs ...string) func(sender string) bool {
+	allowed := make(map[string]empty, len(wxIDs))
+	for _, wxID := range wxIDs {
+		allowed[wxID] = empty{}
+	}
+	return func(sender string) bool {
+		_, ok := allowed[sender]
+		return ok
+	}
+}
+
+// trimMentions removes the leading mentions like "@bot " from the text.
+func trimMentions(text string) string {
+	for {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if !strings.HasPrefix(text, "@") {
+			return text
+		}
+		i := strings.IndexFunc(text, unicode.IsSpace)
+		if i < 0 {
+			return ""
+		}
+		text = text[i:]
+	}
+}
+
+// tokenize splits the text by spaces, the quoted parts are kept as a whole.
+func tokenize(text string) ([]string, error) {
+	var (
+		tokens  []string
+		current strings.Builder
+		quote   rune
+		inToken bool
+	)
+	for _, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inToken = r, true
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inToken {
+		tokens = append(tokens, current.String())
+	}
+	return tokens, nil
+}
@@ -0,0 +1,79 @@
+package wxhelper
+
+import "testing"
+
+func TestTokenize(t *testing.T) {
+	tokens, err := tokenize(`weather "new york"  --days=3 'a b'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"weather", "new york", "--days=3", "a b"}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, tokens)
+	}
+	for i := range expected {
+		if tokens[i] != expected[i] {
+			t.Fatalf("expected %s, got %s", expected[i], tokens[i])
+		}
+	}
+	if _, err = tokenize(`"unterminated`); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestCommandParse(t *testing.T) {
+	command := &Command{
+		Name: "weather",
+		Args: []Arg{
+			{Name: "city", Required: true},
+			{Name: "note", Variadic: true},
+		},
+		Flags: []Flag{
+			{Name: "days", Short: "d", Type: ArgInt, Default: 1},
+			{Name: "verbose", Type: ArgBool},
+		},
+	}
+	values, err := command.parse([]string{"beijing", "-d", "3", "--verbose", "bring", "umbrella"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["city"] != "beijing" {
+		t.Fatalf("expected beijing, got %v", values["city"])
+	}
+	if values["days"] != 3 {
+		t.Fatalf("expected 3, got %v", values["days"])
+	}
+	if values["verbose"] != true {
+		t.Fatalf("expected true, got %v", values["verbose"])
+	}
+	if values["note"] != "bring umbrella" {
+		t.Fatalf("expected bring umbrella, got %v", values["note"])
+	}
+
+	values, err = command.parse([]string{"shanghai"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["days"] != 1 {
+		t.Fatalf("expected default 1, got %v", values["days"])
+	}
+
+	if _, err = command.parse(nil); err == nil {
+		t.Fatal("expected missing argument error, got nil")
+	}
+	if _, err = command.parse([]string{"beijing", "--days=abc"}); err == nil {
+		t.Fatal("expected invalid value error, got nil")
+	}
+	if _, err = command.parse([]string{"beijing", "--unknown"}); err == nil {
+		t.Fatal("expected unknown flag error, got nil")
+	}
+}
+
+func TestTrimMentions(t *testing.T) {
+	if text := trimMentions("@bot /help"); text != "/help" {
+		t.Fatalf("expected /help, got %s", text)
+	}
+	if text := trimMentions("/kick @someone"); text != "/kick @someone" {
+		t.Fatalf("expected /kick @someone, got %s", text)
+	}
+}
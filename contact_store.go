@@ -0,0 +1,209 @@
+package wxhelper
+
+import (
+	"context"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultContactTTL                = 5 * time.Minute
+	defaultContactMinRefreshInterval = 10 * time.Second
+)
+
+// ContactStore 缓存通讯录，并按照 wxid、昵称和备注建立索引。
+// Account.Friends 和 Account.Groups 返回的完整列表的 SearchByWxID、SearchByNickname 和 SearchByRemark 直接使用索引。
+// 缓存过期后先返回旧的通讯录，同时在后台重新拉取；查找不到联系人时会重新拉取通讯录。
+// apiserver 没有获取单个联系人完整信息的接口，所以每次都是拉取整个通讯录。
+type ContactStore struct {
+	// TTL is how long the cached contact list is fresh, defaults to 5 minutes.
+	TTL time.Duration
+	// MinRefreshInterval limits the refreshes caused by lookup misses, defaults to 10 seconds.
+	MinRefreshInterval time.Duration
+
+	client     *Client
+	refreshing singleflight.Group
+	// background 表示正在后台刷新过期的缓存
+	background atomic.Bool
+
+	mu        sync.RWMutex
+	members   Members
+	index     *contactIndex
+	updatedAt time.Time
+}
+
+// contactIndex 是一次刷新得到的通讯录的索引，建立之后只读
+type contactIndex struct {
+	byWxID     map[string]*User
+	byNickname map[string][]*User
+	byRemark   map[string][]*User
+	// friends 和 groups 是好友和群的数量，用来判断列表是否是完整的通讯录
+	friends int
+	groups  int
+}
+
+func newContactIndex(members Members) *contactIndex {
+	index := &contactIndex{
+		byWxID:     make(map[string]*User, len(members)),
+		byNickname: make(map[string][]*User),
+		byRemark:   make(map[string][]*User),
+	}
+	for _, member := range members {
+		member.index = index
+		index.byWxID[member.Wxid] = member
+		index.byNickname[member.Nickname] = append(index.byNickname[member.Nickname], member)
+		if member.Remark != "" {
+			index.byRemark[member.Remark] = append(index.byRemark[member.Remark], member)
+		}
+		switch {
+		case member.IsFriend():
+			index.friends++
+		case member.IsGroup():
+			index.groups++
+		}
+	}
+	return index
+}
+
+// search returns the clones of the users matched by the filter with the owner, at most limit if it is not 0.
+func (index *contactIndex) search(users []*User, owner func() *Account, limit uint, filter func(user *User) bool) Members {
+	result := make(Members, 0)
+	for _, user := range users {
+		if !filter(user) {
+			continue
+		}
+		clone := *user
+		clone.owner = owner
+		result = append(result, &clone)
+		if uint(len(result)) == limit {
+			break
+		}
+	}
+	return result
+}
+
+func (s *ContactStore) ttl() time.Duration {
+	if s.TTL <= 0 {
+		return defaultContactTTL
+	}
+	return s.TTL
+}
+
+func (s *ContactStore) minRefreshInterval() time.Duration {
+	if s.MinRefreshInterval <= 0 {
+		return defaultContactMinRefreshInterval
+	}
+	return s.MinRefreshInterval
+}
+
+// Refresh fetches the contact list and rebuilds the indexes.
+// Concurrent refreshes share one request.
+func (s *ContactStore) Refresh(ctx context.Context) error {
+	_, err, _ := s.refreshing.Do("refresh", func() (any, error) {
+		members, err := s.client.GetContactList(ctx)
+		if err != nil {
+			return nil, err
+		}
+		index := newContactIndex(members)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.members, s.index = members, index
+		s.updatedAt = time.Now()
+		return nil, nil
+	})
+	return err
+}
+
+// Invalidate drops the cache, the next lookup reloads it before returning.
+func (s *ContactStore) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updatedAt = time.Time{}
+}
+
+// UpdatedAt returns the time of the last successful refresh.
+func (s *ContactStore) UpdatedAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.updatedAt
+}
+
+// ensureFresh loads the cache if it is empty or invalidated.
+// An expired cache is still used while it is refreshed in the background.
+func (s *ContactStore) ensureFresh(ctx context.Context) error {
+	updatedAt := s.UpdatedAt()
+	if updatedAt.IsZero() {
+		return s.Refresh(ctx)
+	}
+	if time.Since(updatedAt) >= s.ttl() && s.background.CompareAndSwap(false, true) {
+		go func() {
+			defer s.background.Store(false)
+			if err := s.Refresh(context.WithoutCancel(ctx)); err != nil {
+				log.Error().Err(err).Msg("refresh contacts")
+			}
+		}()
+	}
+	return nil
+}
+
+// Members returns all the contacts.
+func (s *ContactStore) Members(ctx context.Context) (Members, error) {
+	if err := s.ensureFresh(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyUsers(s.members), nil
+}
+
+// Get returns the contact of the wxid.
+// It refreshes the cache once if the contact is not found, the new friends may be missing.
+func (s *ContactStore) Get(ctx context.Context, wxID string) (*User, error) {
+	if err := s.ensureFresh(ctx); err != nil {
+		return nil, err
+	}
+	if user, ok := s.lookup(wxID); ok {
+		return user, nil
+	}
+	if time.Since(s.UpdatedAt()) < s.minRefreshInterval() {
+		return nil, ErrNoSuchUserFound
+	}
+	if err := s.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	if user, ok := s.lookup(wxID); ok {
+		return user, nil
+	}
+	return nil, ErrNoSuchUserFound
+}
+
+func (s *ContactStore) lookup(wxID string) (*User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.index == nil {
+		return nil, false
+	}
+	user, ok := s.index.byWxID[wxID]
+	if !ok {
+		return nil, false
+	}
+	clone := *user
+	return &clone, true
+}
+
+// copyUsers copies the cached users, so that callers can set the owner without affecting the cache.
+func copyUsers(users []*User) Members {
+	result := make(Members, 0, len(users))
+	for _, user := range users {
+		clone := *user
+		result = append(result, &clone)
+	}
+	return result
+}
+
+func newContactStore(client *Client) *ContactStore {
+	return &ContactStore{client: client}
+}
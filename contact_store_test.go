@@ -0,0 +1,160 @@
+package wxhelper
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/eatmoreapple/wxhelper/apiserver"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestContactStore(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		contacts = Members{{Wxid: "wxid_a", Nickname: "Alice"}}
+		fetches  int
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiserver.GetContactList, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		_ = json.NewEncoder(w).Encode(apiserver.OK(contacts))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	fetched := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches
+	}
+
+	bot := New(server.URL)
+	store := bot.Contacts()
+	store.TTL = time.Hour
+	store.MinRefreshInterval = 50 * time.Millisecond
+	ctx := bot.Context()
+
+	// 第一次查找时拉取通讯录，之后使用缓存
+	for i := 0; i < 3; i++ {
+		if user, err := store.Get(ctx, "wxid_a"); err != nil || user.Nickname != "Alice" {
+			t.Fatalf("unexpected user %v, %v", user, err)
+		}
+	}
+	if n := fetched(); n != 1 {
+		t.Fatalf("expected 1 fetch, got %d", n)
+	}
+
+	// 查找不到的联系人在 MinRefreshInterval 内不会重新拉取
+	mu.Lock()
+	contacts = append(contacts, &User{Wxid: "wxid_b", Nickname: "Bob"})
+	mu.Unlock()
+	if _, err := store.Get(ctx, "wxid_b"); !errors.Is(err, ErrNoSuchUserFound) {
+		t.Fatalf("expected %v, got %v", ErrNoSuchUserFound, err)
+	}
+	if n := fetched(); n != 1 {
+		t.Fatalf("expected 1 fetch, got %d", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if user, err := store.Get(ctx, "wxid_b"); err != nil || user.Nickname != "Bob" {
+		t.Fatalf("unexpected user %v, %v", user, err)
+	}
+	if n := fetched(); n != 2 {
+		t.Fatalf("expected 2 fetches, got %d", n)
+	}
+
+	// 过期之后先返回旧的通讯录，同时在后台刷新
+	mu.Lock()
+	contacts = Members{{Wxid: "wxid_a", Nickname: "Alice2"}}
+	mu.Unlock()
+	store.TTL = time.Nanosecond
+	if user, err := store.Get(ctx, "wxid_a"); err != nil || user.Nickname != "Alice" {
+		t.Fatalf("expected the cached user, got %v, %v", user, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		store.TTL = time.Hour
+		if user, err := store.Get(ctx, "wxid_a"); err == nil && user.Nickname == "Alice2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the expired cache is not refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Invalidate 之后同步重新拉取
+	mu.Lock()
+	contacts = Members{{Wxid: "wxid_a", Nickname: "Alice3"}}
+	mu.Unlock()
+	store.Invalidate()
+	if user, err := store.Get(ctx, "wxid_a"); err != nil || user.Nickname != "Alice3" {
+		t.Fatalf("unexpected user %v, %v", user, err)
+	}
+}
+
+func TestContactIndex(t *testing.T) {
+	contacts := Members{
+		{Wxid: "wxid_a", Nickname: "Alice", Remark: "同事", Type: 3},
+		{Wxid: "wxid_b", Nickname: "Bob", Remark: "同事", Type: 3},
+		{Wxid: "wxid_c", Nickname: "Alice", Type: 3},
+		{Wxid: "123@chatroom", Nickname: "测试群"},
+		{Wxid: "456@chatroom", Nickname: "测试群"},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiserver.GetContactList, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(apiserver.OK(contacts))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	bot := New(server.URL)
+	account := &Account{Wxid: "wxid_bot", bot: bot}
+
+	friends, err := account.Friends()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 完整的好友列表使用索引
+	if friends.indexed() == nil {
+		t.Fatal("expected the friends to be indexed")
+	}
+	if search := friends.SearchByNickname("Alice", 0); len(search) != 2 || search[0].Wxid != "wxid_a" || search[1].Wxid != "wxid_c" {
+		t.Fatalf("unexpected friends %v", search)
+	}
+	if search := friends.SearchByRemark("同事", 1); len(search) != 1 || search[0].Wxid != "wxid_a" || search[0].Owner() != account {
+		t.Fatalf("unexpected friends %v", search)
+	}
+	if friend, ok := friends.SearchByWxID("wxid_b"); !ok || friend.Nickname != "Bob" {
+		t.Fatalf("unexpected friend %v", friend)
+	}
+	// 群不会出现在好友的搜索结果中
+	if _, ok := friends.SearchByWxID("123@chatroom"); ok {
+		t.Fatal("expected the group not to be found in the friends")
+	}
+
+	// 部分列表不使用索引，只在列表中查找
+	subset := friends[1:]
+	if subset.indexed() != nil {
+		t.Fatal("expected the subset not to be indexed")
+	}
+	if search := subset.SearchByNickname("Alice", 0); len(search) != 1 || search[0].Wxid != "wxid_c" {
+		t.Fatalf("unexpected friends %v", search)
+	}
+
+	groups, err := account.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups.indexed() == nil {
+		t.Fatal("expected the groups to be indexed")
+	}
+	if search := groups.SearchByNickname("测试群", 0); len(search) != 2 {
+		t.Fatalf("unexpected groups %v", search)
+	}
+	if group, ok := groups.SearchByWxID("456@chatroom"); !ok || group.Owner() != account {
+		t.Fatalf("unexpected group %v", group)
+	}
+}
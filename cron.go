@@ -0,0 +1,158 @@
+package wxhelper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronDescriptors 是预定义的 cron 表达式
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames   = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	weekdayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// CronSchedule 是解析后的 cron 表达式，格式为 "分 时 日 月 周"
+type CronSchedule struct {
+	minute, hour, day, month, weekday uint64
+	// 日和周都有限制时，满足其中一个即可
+	dayStar, weekdayStar bool
+}
+
+// ParseCron parses a standard 5 fields cron expression, such as "30 9 * * 1-5",
+// or one of the descriptors @yearly, @monthly, @weekly, @daily and @hourly.
+func ParseCron(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if descriptor, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+		expr = descriptor
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron: expected 5 fields, got %d in %q", len(fields), expr)
+	}
+	var (
+		schedule CronSchedule
+		err      error
+	)
+	if schedule.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if schedule.day, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, err
+	}
+	// 周日可以写作 0 或者 7
+	if schedule.weekday, err = parseCronField(fields[4], 0, 7, weekdayNames); err != nil {
+		return nil, err
+	}
+	if schedule.weekday&(1<<7) != 0 {
+		schedule.weekday |= 1
+	}
+	schedule.dayStar = strings.HasPrefix(fields[2], "*")
+	schedule.weekdayStar = strings.HasPrefix(fields[4], "*")
+	return &schedule, nil
+}
+
+// parseCronField parses a field made of comma separated "*", "n", "a-b" with an optional "/step".
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepExpr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("cron: invalid step in %q", item)
+			}
+		}
+		var start, end int
+		switch {
+		case rangeExpr == "*":
+			start, end = min, max
+		case strings.Contains(rangeExpr, "-"):
+			from, to, _ := strings.Cut(rangeExpr, "-")
+			var err error
+			if start, err = parseCronValue(from, names); err != nil {
+				return 0, err
+			}
+			if end, err = parseCronValue(to, names); err != nil {
+				return 0, err
+			}
+		default:
+			value, err := parseCronValue(rangeExpr, names)
+			if err != nil {
+				return 0, err
+			}
+			start, end = value, value
+			// "5/10" 表示从 5 开始每隔 10
+			if hasStep {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("cron: %q out of range [%d, %d]", item, min, max)
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if number, ok := names[strings.ToLower(value)]; ok {
+		return number, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("cron: invalid value %q", value)
+	}
+	return number, nil
+}
+
+func (s *CronSchedule) matchDay(t time.Time) bool {
+	day := s.day&(1<<uint(t.Day())) != 0
+	weekday := s.weekday&(1<<uint(t.Weekday())) != 0
+	if !s.dayStar && !s.weekdayStar {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// Next returns the first time after t that matches the schedule,
+// or the zero time if there is none in 5 years.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
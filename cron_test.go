@@ -0,0 +1,43 @@
+package wxhelper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	base := time.Date(2024, 1, 31, 9, 30, 20, 0, time.UTC) // Wednesday
+	cases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 9, 31, 0, 0, time.UTC)},
+		{"30 9 * * *", time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 9, 45, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 10 * * 0,6", time.Date(2024, 2, 3, 10, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		// 日和周都有限制时满足其一即可
+		{"0 0 15 * 5", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, 2, 4, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		schedule, err := ParseCron(c.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		if next := schedule.Next(base); !next.Equal(c.next) {
+			t.Fatalf("%s: expected %s, got %s", c.expr, c.next, next)
+		}
+	}
+}
+
+func TestParseCronError(t *testing.T) {
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Fatalf("%s: expected error", expr)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package wxhelper
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// Dispatcher 调度 MessageHandler 的执行
+type Dispatcher interface {
+	// Dispatch schedules the handler for the message.
+	Dispatch(msg *Message, handler MessageHandler)
+
+	// Shutdown stops accepting messages and waits for the accepted ones to be handled.
+	// It returns the context's error if ctx expires first.
+	Shutdown(ctx context.Context) error
+}
+
+// UnboundedDispatcher 每条消息启动一个 goroutine 处理，不保证顺序，也不限制并发
+type UnboundedDispatcher struct {
+	handlers sync.WaitGroup
+}
+
+func (d *UnboundedDispatcher) Dispatch(msg *Message, handler MessageHandler) {
+	d.handlers.Add(1)
+	go func() {
+		defer d.handlers.Done()
+		handler(msg)
+	}()
+}
+
+func (d *UnboundedDispatcher) Shutdown(ctx context.Context) error {
+	return waitContext(ctx, d.handlers.Wait)
+}
+
+// OverflowPolicy 会话队列满了之后的处理方式
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the dispatching until the queue has space.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued message of the conversation.
+	OverflowDropOldest
+	// OverflowDropNewest drops the incoming message.
+	OverflowDropNewest
+)
+
+// ConversationKey returns the key of the conversation the message belongs to,
+// which is the group id for group messages and the peer wxid for private messages.
+func ConversationKey(msg *Message) string {
+	return msg.FromUser
+}
+
+type dispatchItem struct {
+	msg     *Message
+	handler MessageHandler
+}
+
+type conversationQueue struct {
+	key   string
+	items []dispatchItem
+}
+
+// ConversationDispatcher 按会话将消息放入串行队列，由有限数量的 worker 处理。
+// 同一个会话中的消息按顺序依次处理，不同会话之间并发处理。
+type ConversationDispatcher struct {
+	// MaxConcurrency is the number of workers, defaults to runtime.NumCPU().
+	MaxConcurrency int
+	// QueueSize is the max queued messages of one conversation, defaults to 100.
+	QueueSize int
+	// Overflow decides what to do when a conversation queue is full.
+	Overflow OverflowPolicy
+	// OnDrop is called with the messages dropped by the overflow policy or after shutdown.
+	OnDrop func(msg *Message)
+
+	mu sync.Mutex
+	// ready 唤醒等待可运行会话的 worker
+	ready *sync.Cond
+	// idle 唤醒等待队列空间的 Dispatch 和等待处理完成的 Shutdown
+	idle     *sync.Cond
+	starting sync.Once
+	queues   map[string]*conversationQueue
+	runnable []*conversationQueue
+	pending  int
+	closed   bool
+}
+
+func (d *ConversationDispatcher) start() {
+	d.starting.Do(func() {
+		d.ready = sync.NewCond(&d.mu)
+		d.idle = sync.NewCond(&d.mu)
+		d.queues = make(map[string]*conversationQueue)
+		workers := d.MaxConcurrency
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		for i := 0; i < workers; i++ {
+			go d.work()
+		}
+	})
+}
+
+func (d *ConversationDispatcher) queueSize() int {
+	if d.QueueSize <= 0 {
+		return 100
+	}
+	return d.QueueSize
+}
+
+func (d *ConversationDispatcher) Dispatch(msg *Message, handler MessageHandler) {
+	d.start()
+	key := ConversationKey(msg)
+
+	d.mu.Lock()
+	var dropped *Message
+	defer func() {
+		d.mu.Unlock()
+		if dropped != nil && d.OnDrop != nil {
+			d.OnDrop(dropped)
+		}
+	}()
+
+	queue, exists := d.queues[key]
+	for exists && len(queue.items) >= d.queueSize() && !d.closed {
+		switch d.Overflow {
+		case OverflowDropNewest:
+			dropped = msg
+			return
+		case OverflowDropOldest:
+			dropped = queue.items[0].msg
+			queue.items = queue.items[1:]
+			d.pending--
+		default:
+			d.idle.Wait()
+			// the queue may be removed while waiting
+			queue, exists = d.queues[key]
+		}
+	}
+	if d.closed {
+		dropped = msg
+		return
+	}
+	if !exists {
+		queue = &conversationQueue{key: key}
+		d.queues[key] = queue
+		d.runnable = append(d.runnable, queue)
+		d.ready.Signal()
+	}
+	queue.items = append(queue.items, dispatchItem{msg: msg, handler: handler})
+	d.pending++
+}
+
+// work takes one message from a runnable conversation at a time, a conversation is
+// owned by at most one worker, so its messages are handled in order.
+func (d *ConversationDispatcher) work() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for {
+		for len(d.runnable) == 0 && !(d.closed && d.pending == 0) {
+			d.ready.Wait()
+		}
+		if len(d.runnable) == 0 {
+			return
+		}
+		queue := d.runnable[0]
+		d.runnable = d.runnable[1:]
+		item := queue.items[0]
+		queue.items = queue.items[1:]
+		// wake up the blocked dispatching
+		d.idle.Broadcast()
+
+		d.mu.Unlock()
+		item.handler(item.msg)
+		d.mu.Lock()
+
+		d.pending--
+		if len(queue.items) > 0 {
+			d.runnable = append(d.runnable, queue)
+			d.ready.Signal()
+		} else {
+			delete(d.queues, queue.key)
+		}
+		d.idle.Broadcast()
+		if d.closed && d.pending == 0 {
+			// let the idle workers exit
+			d.ready.Broadcast()
+		}
+	}
+}
+
+func (d *ConversationDispatcher) Shutdown(ctx context.Context) error {
+	d.start()
+	d.mu.Lock()
+	d.closed = true
+	d.ready.Broadcast()
+	d.idle.Broadcast()
+	d.mu.Unlock()
+	return waitContext(ctx, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		for d.pending > 0 {
+			d.idle.Wait()
+		}
+	})
+}
+
+// waitContext waits for the wait function to return or the context to be done.
+func waitContext(ctx context.Context, wait func()) error {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
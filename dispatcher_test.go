@@ -0,0 +1,156 @@
+package wxhelper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConversationDispatcherOrder(t *testing.T) {
+	dispatcher := &ConversationDispatcher{MaxConcurrency: 4, QueueSize: 10}
+	var (
+		mu      sync.Mutex
+		handled = make(map[string][]int)
+	)
+	handler := func(msg *Message) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		handled[msg.FromUser] = append(handled[msg.FromUser], int(msg.MsgId))
+		mu.Unlock()
+	}
+	for i := 0; i < 50; i++ {
+		for _, from := range []string{"wxid_a", "wxid_b", "123@chatroom"} {
+			dispatcher.Dispatch(&Message{FromUser: from, MsgId: int64(i)}, handler)
+		}
+	}
+	if err := dispatcher.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 同一个会话中的消息按顺序处理
+	for from, ids := range handled {
+		if len(ids) != 50 {
+			t.Fatalf("%s: expected 50 messages, got %d", from, len(ids))
+		}
+		for i, id := range ids {
+			if id != i {
+				t.Fatalf("%s: expected message %d, got %d", from, i, id)
+			}
+		}
+	}
+}
+
+func TestConversationDispatcherConcurrency(t *testing.T) {
+	dispatcher := &ConversationDispatcher{MaxConcurrency: 3, QueueSize: 1}
+	var running, peak atomic.Int32
+	handler := func(msg *Message) {
+		n := running.Add(1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+	}
+	// 队列满了之后阻塞，直到 worker 取走消息
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				dispatcher.Dispatch(&Message{FromUser: fmt.Sprintf("wxid_%d", i), MsgId: int64(j)}, handler)
+			}
+		}(i)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("blocked dispatching is never woken up")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := dispatcher.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := peak.Load(); n > 3 {
+		t.Fatalf("expected at most 3 concurrent handlers, got %d", n)
+	}
+}
+
+func TestConversationDispatcherDrop(t *testing.T) {
+	for _, c := range []struct {
+		overflow OverflowPolicy
+		handled  []int64
+		dropped  []int64
+	}{
+		{OverflowDropNewest, []int64{0, 1, 2}, []int64{3, 4}},
+		{OverflowDropOldest, []int64{0, 3, 4}, []int64{1, 2}},
+	} {
+		var (
+			mu      sync.Mutex
+			handled []int64
+			dropped []int64
+		)
+		release := make(chan struct{})
+		started := make(chan struct{}, 1)
+		dispatcher := &ConversationDispatcher{
+			MaxConcurrency: 1,
+			QueueSize:      2,
+			Overflow:       c.overflow,
+			OnDrop: func(msg *Message) {
+				mu.Lock()
+				dropped = append(dropped, msg.MsgId)
+				mu.Unlock()
+			},
+		}
+		handler := func(msg *Message) {
+			if msg.MsgId == 0 {
+				started <- struct{}{}
+				<-release
+			}
+			mu.Lock()
+			handled = append(handled, msg.MsgId)
+			mu.Unlock()
+		}
+		dispatcher.Dispatch(&Message{FromUser: "wxid_a", MsgId: 0}, handler)
+		// 第一条消息处理中，后面的消息排队
+		<-started
+		for i := int64(1); i < 5; i++ {
+			dispatcher.Dispatch(&Message{FromUser: "wxid_a", MsgId: i}, handler)
+		}
+		close(release)
+		if err := dispatcher.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		// 关闭之后的消息被丢弃
+		dispatcher.Dispatch(&Message{FromUser: "wxid_a", MsgId: 5}, handler)
+		if fmt.Sprint(handled) != fmt.Sprint(c.handled) {
+			t.Fatalf("expected handled %v, got %v", c.handled, handled)
+		}
+		if expected := append(c.dropped, 5); fmt.Sprint(dropped) != fmt.Sprint(expected) {
+			t.Fatalf("expected dropped %v, got %v", expected, dropped)
+		}
+	}
+}
+
+func TestConversationDispatcherShutdownTimeout(t *testing.T) {
+	dispatcher := &ConversationDispatcher{MaxConcurrency: 1}
+	release := make(chan struct{})
+	defer close(release)
+	dispatcher.Dispatch(&Message{FromUser: "wxid_a"}, func(msg *Message) { <-release })
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := dispatcher.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
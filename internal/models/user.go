@@ -32,4 +32,6 @@ type Profile struct {
 	Nickname  string `json:"nickname"`
 	V3        string `json:"v3"`
 	Wxid      string `json:"wxid"`
+	// DisplayName 是成员在群里的昵称，只有获取群成员时才有
+	DisplayName string `json:"displayName,omitempty"`
 }
@@ -7,12 +7,46 @@ import (
 	"fmt"
 	"github.com/eatmoreapple/env"
 	. "github.com/eatmoreapple/wxhelper/internal/models"
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// ErrUnsupported 表示注入服务器没有提供该接口
+var ErrUnsupported = errors.New("unsupported by the inject server")
+
+// ErrSendAppMsg 表示注入服务器发送 appmsg 失败，例如不支持引用消息的版本
+var ErrSendAppMsg = errors.New("send app msg failed")
+
+var (
+	// ErrNotChatRoomAdmin 表示登录的账号不是群主或者管理员
+	ErrNotChatRoomAdmin = errors.New("not the owner or an admin of the chat room")
+	// ErrNotChatRoomMember 表示操作的成员不在群里
+	ErrNotChatRoomMember = errors.New("not a member of the chat room")
+)
+
+// 注入服务器群管理接口返回的错误码，1 表示成功
+const (
+	chatRoomCodeNotAdmin  = -2
+	chatRoomCodeNotMember = -3
+)
+
+// chatRoomError decodes the result code of the chat room operation.
+func chatRoomError(op string, code int) error {
+	switch {
+	case code > 0:
+		return nil
+	case code == chatRoomCodeNotAdmin:
+		return fmt.Errorf("%s: %w", op, ErrNotChatRoomAdmin)
+	case code == chatRoomCodeNotMember:
+		return fmt.Errorf("%s: %w", op, ErrNotChatRoomMember)
+	default:
+		return fmt.Errorf("%s failed with code %d", op, code)
+	}
+}
+
 type Client struct {
 	transport *Transport
 }
@@ -319,6 +353,88 @@ func (c *Client) QuitChatRoom(ctx context.Context, chatRoomId string) error {
 	return nil
 }
 
+// DelMemberFromChatRoom 把成员移出群聊，需要是群主或者管理员
+func (c *Client) DelMemberFromChatRoom(ctx context.Context, chatRoomID string, memberIDs []string) error {
+	resp, err := c.transport.DelMemberFromChatRoom(ctx, chatRoomID, memberIDs...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var r result[any]
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	return chatRoomError("del member from chat room", r.Code)
+}
+
+// ModifyNickname 修改 wxid 在群里的昵称，只能修改自己的
+func (c *Client) ModifyNickname(ctx context.Context, chatRoomID, wxID, nickname string) error {
+	resp, err := c.transport.ModifyNickname(ctx, chatRoomID, wxID, nickname)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var r result[any]
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	return chatRoomError("modify nickname", r.Code)
+}
+
+// DownloadAttach 下载视频或者文件到 CurrentDataPath\wxhelper 目录
+func (c *Client) DownloadAttach(ctx context.Context, msgID int64) error {
+	resp, err := c.transport.DownloadAttach(ctx, msgID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var r result[any]
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	if r.Code < 0 {
+		return errors.New("download attach failed")
+	}
+	return nil
+}
+
+// GetVoiceByMsgID 把语音保存为 storeDir 目录下的 {msgId}.amr，storeDir 是 windows 路径
+func (c *Client) GetVoiceByMsgID(ctx context.Context, msgID int64, storeDir string) error {
+	resp, err := c.transport.GetVoiceByMsgID(ctx, msgID, storeDir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var r result[any]
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	if r.Code < 0 {
+		return errors.New("get voice failed")
+	}
+	return nil
+}
+
+// SendAppMsg 发送 type 49 的 appmsg，content 是 <msg><appmsg>...</appmsg></msg> 的 xml
+func (c *Client) SendAppMsg(ctx context.Context, to, content string) error {
+	resp, err := c.transport.SendAppMsg(ctx, to, content)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUnsupported
+	}
+	var r result[any]
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	if r.Code != 1 {
+		return ErrSendAppMsg
+	}
+	return nil
+}
+
 func New(transport *Transport) *Client {
 	return &Client{transport: transport}
 }
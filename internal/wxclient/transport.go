@@ -363,6 +363,65 @@ func (c *Transport) QuitChatRoom(ctx context.Context, chatRoomId string) (*http.
 	return http.DefaultClient.Do(req)
 }
 
+func (c *Transport) DownloadAttach(ctx context.Context, msgID int64) (*http.Response, error) {
+	url, err := urlpkg.Parse(c.BaseURL + "/api/downloadAttach")
+	if err != nil {
+		return nil, err
+	}
+	var payload = map[string]int64{
+		"msgId": msgID,
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func (c *Transport) GetVoiceByMsgID(ctx context.Context, msgID int64, storeDir string) (*http.Response, error) {
+	url, err := urlpkg.Parse(c.BaseURL + "/api/getVoiceByMsgId")
+	if err != nil {
+		return nil, err
+	}
+	var payload = map[string]interface{}{
+		"msgId":    msgID,
+		"storeDir": storeDir,
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func (c *Transport) SendAppMsg(ctx context.Context, to, content string) (*http.Response, error) {
+	url, err := urlpkg.Parse(c.BaseURL + "/api/sendAppMsg")
+	if err != nil {
+		return nil, err
+	}
+	var payload = map[string]string{
+		"wxid": to,
+		"xml":  content,
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
+
 func NewTransport(baseURL string) *Transport {
 	return &Transport{BaseURL: baseURL}
 }
@@ -0,0 +1,129 @@
+package wxhelper
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Matcher 判断消息是否命中某条路由
+type Matcher func(msg *Message) bool
+
+// And returns a Matcher that matches only if m and all the others match.
+func (m Matcher) And(others ...Matcher) Matcher {
+	return MatchAll(append([]Matcher{m}, others...)...)
+}
+
+// Or returns a Matcher that matches if m or any of the others match.
+func (m Matcher) Or(others ...Matcher) Matcher {
+	return MatchAny(append([]Matcher{m}, others...)...)
+}
+
+// Not returns a Matcher that inverts m.
+func (m Matcher) Not() Matcher {
+	return func(msg *Message) bool { return !m(msg) }
+}
+
+// MatchAll returns a Matcher that matches if all the matchers match.
+// It matches every message if no matcher is given.
+func MatchAll(matchers ...Matcher) Matcher {
+	return func(msg *Message) bool {
+		for _, matcher := range matchers {
+			if !matcher(msg) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// MatchAny returns a Matcher that matches if any of the matchers match.
+func MatchAny(matchers ...Matcher) Matcher {
+	return func(msg *Message) bool {
+		for _, matcher := range matchers {
+			if matcher(msg) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchType matches messages with one of the given types.
+func MatchType(types ...int) Matcher {
+	return func(msg *Message) bool {
+		for _, t := range types {
+			if msg.Type == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchText matches text messages.
+func MatchText() Matcher {
+	return func(msg *Message) bool { return msg.IsText() }
+}
+
+// MatchImage matches image messages.
+func MatchImage() Matcher {
+	return func(msg *Message) bool { return msg.IsImage() }
+}
+
+// MatchGroup matches messages sent in a group.
+func MatchGroup() Matcher {
+	return func(msg *Message) bool { return msg.IsGroupMessage() }
+}
+
+// MatchPrivate matches messages sent in a private chat.
+func MatchPrivate() Matcher {
+	return func(msg *Message) bool { return !msg.IsGroupMessage() }
+}
+
+// MatchAtMe matches group messages that mention the current account.
+func MatchAtMe() Matcher {
+	return func(msg *Message) bool { return msg.IsAtMe() }
+}
+
+// MatchFromUser matches messages whose FromUser is one of the given wxids.
+// For group messages FromUser is the group id.
+func MatchFromUser(wxIDs ...string) Matcher {
+	return func(msg *Message) bool {
+		for _, wxID := range wxIDs {
+			if msg.FromUser == wxID {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchSender matches messages sent by one of the given wxids.
+// For group messages it is the speaking member.
+func MatchSender(wxIDs ...string) Matcher {
+	return func(msg *Message) bool {
+		senderID := msg.SenderID()
+		for _, wxID := range wxIDs {
+			if senderID == wxID {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchContent matches messages whose text equals to the given content.
+// The sender prefix of group messages is not part of the text, see Message.Text.
+func MatchContent(content string) Matcher {
+	return func(msg *Message) bool { return msg.Text() == content }
+}
+
+// MatchPrefix matches messages whose text starts with the given prefix.
+func MatchPrefix(prefix string) Matcher {
+	return func(msg *Message) bool { return strings.HasPrefix(msg.Text(), prefix) }
+}
+
+// MatchRegexp matches messages whose text matches the given regular expression.
+func MatchRegexp(expr *regexp.Regexp) Matcher {
+	return func(msg *Message) bool { return expr.MatchString(msg.Text()) }
+}
@@ -0,0 +1,313 @@
+package wxhelper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNoMembers is returned when the member list of a watched group is empty,
+// the bot itself is always a member, so the list is not trusted.
+var ErrNoMembers = errors.New("no members in the group")
+
+// MembershipEvent 是对比群成员快照得到的事件，具体类型为 *MemberJoined、*MemberLeft 或者 *MemberRenamed
+type MembershipEvent interface {
+	// GroupID returns the wxid of the group.
+	GroupID() string
+}
+
+type membershipEvent struct {
+	groupID string
+}
+
+func (e membershipEvent) GroupID() string { return e.groupID }
+
+// MemberJoined 是新快照中出现的成员，包括通过邀请链接进群的成员
+type MemberJoined struct {
+	membershipEvent
+	Member *Profile
+}
+
+// MemberLeft 是新快照中消失的成员，包括被悄悄移出群的成员
+type MemberLeft struct {
+	membershipEvent
+	// Member 是成员在上一次快照中的资料
+	Member *Profile
+}
+
+// MemberRenamed 是修改了昵称或者群昵称的成员
+type MemberRenamed struct {
+	membershipEvent
+	Member *Profile
+	// Previous 是成员在上一次快照中的资料
+	Previous *Profile
+}
+
+// MembershipEventHandlers 群成员变化事件的处理函数，未设置的事件会被忽略
+type MembershipEventHandlers struct {
+	OnMemberJoined  func(event *MemberJoined)
+	OnMemberLeft    func(event *MemberLeft)
+	OnMemberRenamed func(event *MemberRenamed)
+	// OnMembershipEvent is called with every event before the typed handlers.
+	OnMembershipEvent func(event MembershipEvent)
+}
+
+func (h *MembershipEventHandlers) serveMembershipEvent(event MembershipEvent) {
+	if h.OnMembershipEvent != nil {
+		h.OnMembershipEvent(event)
+	}
+	switch event := event.(type) {
+	case *MemberJoined:
+		if h.OnMemberJoined != nil {
+			h.OnMemberJoined(event)
+		}
+	case *MemberLeft:
+		if h.OnMemberLeft != nil {
+			h.OnMemberLeft(event)
+		}
+	case *MemberRenamed:
+		if h.OnMemberRenamed != nil {
+			h.OnMemberRenamed(event)
+		}
+	}
+}
+
+// GroupSnapshot 是某一时刻群成员的列表
+type GroupSnapshot struct {
+	GroupID string     `json:"groupId"`
+	TakenAt time.Time  `json:"takenAt"`
+	Members []*Profile `json:"members"`
+}
+
+// diff returns the events from the previous snapshot to s, in the order of the members.
+func (s *GroupSnapshot) diff(previous *GroupSnapshot) []MembershipEvent {
+	event := membershipEvent{groupID: s.GroupID}
+	before := make(map[string]*Profile, len(previous.Members))
+	for _, member := range previous.Members {
+		before[member.Wxid] = member
+	}
+	var events []MembershipEvent
+	current := make(map[string]bool, len(s.Members))
+	for _, member := range s.Members {
+		current[member.Wxid] = true
+		old, ok := before[member.Wxid]
+		switch {
+		case !ok:
+			events = append(events, &MemberJoined{membershipEvent: event, Member: member})
+		case old.Nickname != member.Nickname || old.DisplayName != member.DisplayName:
+			events = append(events, &MemberRenamed{membershipEvent: event, Member: member, Previous: old})
+		}
+	}
+	for _, member := range previous.Members {
+		if !current[member.Wxid] {
+			events = append(events, &MemberLeft{membershipEvent: event, Member: member})
+		}
+	}
+	return events
+}
+
+// MemberWatcher 定时获取指定群的成员列表，和上一次的快照对比，把成员的变化交给 Bot 的 MembershipEventHandlers。
+// 入群和退群的系统消息并不可靠，例如被悄悄移出群或者通过邀请链接进群时没有系统消息。
+// 快照保存在文件中，重启之后依然和重启之前的快照对比。
+// 事件处理完之后才保存快照，在两者之间退出时重启后会再次发出这些事件，而不会丢失。
+type MemberWatcher struct {
+	// Interval 是两次快照之间的间隔，默认 5 分钟
+	Interval time.Duration
+
+	bot  *Bot
+	path string
+	// checking 保证同一时间只有一个 Check，同一个变化不会被并发的 Check 重复发出
+	checking  sync.Mutex
+	mu        sync.Mutex
+	groups    map[string]bool
+	snapshots map[string]*GroupSnapshot
+}
+
+// Watch adds the groups to watch, the first snapshot of a group only records the members.
+func (w *MemberWatcher) Watch(groupIDs ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, groupID := range groupIDs {
+		w.groups[groupID] = true
+	}
+}
+
+// Unwatch stops watching the group and removes its snapshot.
+func (w *MemberWatcher) Unwatch(groupID string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.groups, groupID)
+	delete(w.snapshots, groupID)
+	return w.save()
+}
+
+// Snapshot returns the last snapshot of the group, nil if it has not been taken.
+func (w *MemberWatcher) Snapshot(groupID string) *GroupSnapshot {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	snapshot, ok := w.snapshots[groupID]
+	if !ok {
+		return nil
+	}
+	clone := *snapshot
+	return &clone
+}
+
+// Check takes a snapshot of every watched group and emits the changes to the Bot.
+// A group that fails is kept at its previous snapshot, the errors are joined.
+func (w *MemberWatcher) Check(ctx context.Context) error {
+	w.checking.Lock()
+	defer w.checking.Unlock()
+	w.mu.Lock()
+	groupIDs := make([]string, 0, len(w.groups))
+	for groupID := range w.groups {
+		groupIDs = append(groupIDs, groupID)
+	}
+	w.mu.Unlock()
+	sort.Strings(groupIDs)
+
+	var errs []error
+	for _, groupID := range groupIDs {
+		if err := w.check(ctx, groupID); err != nil {
+			errs = append(errs, fmt.Errorf("watch members of %s: %w", groupID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (w *MemberWatcher) check(ctx context.Context, groupID string) error {
+	members, err := w.bot.client.GetChatRoomMembers(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	// 接口异常时返回空列表，对比之后所有成员都会被当作退群
+	if len(members) == 0 {
+		return ErrNoMembers
+	}
+	snapshot := &GroupSnapshot{GroupID: groupID, TakenAt: time.Now(), Members: members}
+
+	w.mu.Lock()
+	previous := w.snapshots[groupID]
+	w.mu.Unlock()
+	if previous != nil {
+		for _, event := range snapshot.diff(previous) {
+			w.serveEvent(event)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.groups[groupID] {
+		// 检查期间取消了监听
+		return nil
+	}
+	w.snapshots[groupID] = snapshot
+	return w.save()
+}
+
+// serveEvent passes the event to the bot, a panic of the handler is reported like a message handler.
+func (w *MemberWatcher) serveEvent(event MembershipEvent) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			w.bot.handlePanic(nil, recovered, debug.Stack())
+		}
+	}()
+	w.bot.serveMembershipEvent(event)
+}
+
+// Run checks the watched groups every Interval until the context or the bot is done.
+func (w *MemberWatcher) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	// 跟随 Bot 的生命周期
+	stop := context.AfterFunc(w.bot.Context(), func() { cancel(context.Cause(w.bot.Context())) })
+	defer stop()
+	interval := w.Interval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := w.Check(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("check group members")
+		}
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *MemberWatcher) save() error {
+	if w.path == "" {
+		return nil
+	}
+	snapshots := make([]*GroupSnapshot, 0, len(w.snapshots))
+	for _, snapshot := range w.snapshots {
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].GroupID < snapshots[j].GroupID })
+	data, err := json.MarshalIndent(snapshots, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), filepath.Base(w.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), w.path)
+}
+
+func (w *MemberWatcher) load() error {
+	data, err := os.ReadFile(w.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var snapshots []*GroupSnapshot
+	if err = json.Unmarshal(data, &snapshots); err != nil {
+		return err
+	}
+	for _, snapshot := range snapshots {
+		w.snapshots[snapshot.GroupID] = snapshot
+	}
+	return nil
+}
+
+// NewMemberWatcher returns a MemberWatcher of the groups, the snapshots are saved to the file of the path.
+// The snapshots are kept in memory only if the path is empty.
+func NewMemberWatcher(bot *Bot, path string, groupIDs ...string) (*MemberWatcher, error) {
+	watcher := &MemberWatcher{
+		bot:       bot,
+		path:      path,
+		groups:    make(map[string]bool),
+		snapshots: make(map[string]*GroupSnapshot),
+	}
+	if path != "" {
+		if err := watcher.load(); err != nil {
+			return nil, err
+		}
+	}
+	watcher.Watch(groupIDs...)
+	return watcher, nil
+}
@@ -0,0 +1,145 @@
+package wxhelper
+
+import (
+	"context"
+	"errors"
+	"github.com/eatmoreapple/wxhelper/wxtest"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemberWatcher(t *testing.T) {
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot"})
+	stack.AddGroup("123@chatroom", "测试群",
+		&wxtest.Member{Wxid: "wxid_bot", Nickname: "bot"},
+		&wxtest.Member{Wxid: "wxid_a", Nickname: "Alice"},
+		&wxtest.Member{Wxid: "wxid_b", Nickname: "Bob"},
+	)
+	bot := New(stack.URL)
+	t.Cleanup(bot.Stop)
+	var events []string
+	bot.OnMemberJoined = func(event *MemberJoined) { events = append(events, "join "+event.Member.Wxid) }
+	bot.OnMemberLeft = func(event *MemberLeft) { events = append(events, "leave "+event.Member.Wxid) }
+	bot.OnMemberRenamed = func(event *MemberRenamed) {
+		events = append(events, "rename "+event.Previous.DisplayName+" "+event.Member.DisplayName)
+	}
+
+	path := filepath.Join(t.TempDir(), "members.json")
+	watcher, err := NewMemberWatcher(bot, path, "123@chatroom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	// 第一次快照只记录成员
+	if err = watcher.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no events, got %v", events)
+	}
+
+	// 重启之后和之前的快照对比
+	stack.SetGroupMembers("123@chatroom",
+		&wxtest.Member{Wxid: "wxid_bot", Nickname: "bot"},
+		&wxtest.Member{Wxid: "wxid_a", Nickname: "Alice", DisplayName: "小A"},
+		&wxtest.Member{Wxid: "wxid_c", Nickname: "Carol"},
+	)
+	if watcher, err = NewMemberWatcher(bot, path, "123@chatroom"); err != nil {
+		t.Fatal(err)
+	}
+	if err = watcher.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"rename  小A", "join wxid_c", "leave wxid_b"}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, events)
+		}
+	}
+	if snapshot := watcher.Snapshot("123@chatroom"); snapshot == nil || len(snapshot.Members) != 3 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	// 获取成员失败时保留之前的快照
+	events = nil
+	if err = watcher.Unwatch("123@chatroom"); err != nil {
+		t.Fatal(err)
+	}
+	watcher.Watch("456@chatroom")
+	if err = watcher.Check(ctx); err == nil {
+		t.Fatal("expected error for an unknown group")
+	}
+	if len(events) != 0 || watcher.Snapshot("456@chatroom") != nil {
+		t.Fatalf("unexpected events %v", events)
+	}
+}
+
+func TestMemberWatcherFailures(t *testing.T) {
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot"})
+	stack.AddGroup("123@chatroom", "测试群",
+		&wxtest.Member{Wxid: "wxid_bot", Nickname: "bot"},
+		&wxtest.Member{Wxid: "wxid_a", Nickname: "Alice"},
+	)
+	bot := New(stack.URL)
+	t.Cleanup(bot.Stop)
+	path := filepath.Join(t.TempDir(), "members.json")
+	watcher, err := NewMemberWatcher(bot, path, "123@chatroom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err = watcher.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 空的成员列表不可信，保留之前的快照
+	var left []string
+	bot.OnMemberLeft = func(event *MemberLeft) { left = append(left, event.Member.Wxid) }
+	stack.SetGroupMembers("123@chatroom")
+	if err = watcher.Check(ctx); !errors.Is(err, ErrNoMembers) {
+		t.Fatalf("expected %v, got %v", ErrNoMembers, err)
+	}
+	if len(left) != 0 || len(watcher.Snapshot("123@chatroom").Members) != 2 {
+		t.Fatalf("unexpected left members %v", left)
+	}
+
+	// 处理事件时快照还没有保存，这时退出重启之后会再次发出事件
+	stack.SetGroupMembers("123@chatroom",
+		&wxtest.Member{Wxid: "wxid_bot", Nickname: "bot"},
+		&wxtest.Member{Wxid: "wxid_a", Nickname: "Alice"},
+		&wxtest.Member{Wxid: "wxid_b", Nickname: "Bob"},
+	)
+	var saved *GroupSnapshot
+	bot.OnMemberJoined = func(event *MemberJoined) {
+		restarted, err := NewMemberWatcher(bot, path)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		saved = restarted.Snapshot("123@chatroom")
+		panic("handler panic")
+	}
+	var panics []any
+	bot.OnPanic = func(msg *Message, recovered any, stack []byte) {
+		if msg != nil {
+			t.Errorf("expected nil message, got %v", msg)
+		}
+		panics = append(panics, recovered)
+	}
+	// 处理函数 panic 不影响保存快照
+	if err = watcher.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if saved == nil || len(saved.Members) != 2 {
+		t.Fatalf("expected the previous snapshot to be saved, got %+v", saved)
+	}
+	if len(panics) != 1 || panics[0] != "handler panic" {
+		t.Fatalf("unexpected panics %v", panics)
+	}
+	if restarted, err := NewMemberWatcher(bot, path); err != nil || len(restarted.Snapshot("123@chatroom").Members) != 3 {
+		t.Fatalf("expected the new snapshot to be saved, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package wxhelper
+
+import "strings"
+
+const (
+	// mentionAllID 是 @所有人 的 wxid
+	mentionAllID = "notify@all"
+	// mentionSeparator 是微信在 @昵称 后面使用的空格
+	mentionSeparator = "\u2005"
+)
+
+type messageSegment struct {
+	text string
+	// wxID 不为空时表示 @ 某个成员
+	wxID string
+	name string
+}
+
+// MessageBuilder 组合文本和 @ 成员，生成群消息的内容和 AtList。
+// 被 @ 的成员的名字在发送时根据群成员列表解析，优先使用群昵称。
+type MessageBuilder struct {
+	segments []messageSegment
+}
+
+// Text appends the text.
+func (b *MessageBuilder) Text(text string) *MessageBuilder {
+	b.segments = append(b.segments, messageSegment{text: text})
+	return b
+}
+
+// Mention appends a mention of the member.
+func (b *MessageBuilder) Mention(profile *Profile) *MessageBuilder {
+	return b.MentionID(profile.Wxid, profile.Nickname)
+}
+
+// MentionID appends a mention of the member of the wxid.
+// The name is used if the member is not found in the group.
+func (b *MessageBuilder) MentionID(wxID, name string) *MessageBuilder {
+	b.segments = append(b.segments, messageSegment{wxID: wxID, name: name})
+	return b
+}
+
+// MentionAll appends a mention of all the members, only the group owner and admins can do it.
+func (b *MessageBuilder) MentionAll() *MessageBuilder {
+	b.segments = append(b.segments, messageSegment{wxID: mentionAllID, name: "所有人"})
+	return b
+}
+
+// HasMention reports whether the message mentions anyone.
+func (b *MessageBuilder) HasMention() bool {
+	for _, segment := range b.segments {
+		if segment.wxID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Build returns the content and the wxids to mention, the names of the mentions are
+// resolved from the group members.
+func (b *MessageBuilder) Build(members []*Profile) (content string, atList []string) {
+	names := make(map[string]string, len(members))
+	for _, member := range members {
+		if member.DisplayName != "" {
+			names[member.Wxid] = member.DisplayName
+		} else {
+			names[member.Wxid] = member.Nickname
+		}
+	}
+	var builder strings.Builder
+	seen := make(map[string]struct{})
+	for _, segment := range b.segments {
+		if segment.wxID == "" {
+			builder.WriteString(segment.text)
+			continue
+		}
+		name, ok := names[segment.wxID]
+		if !ok || name == "" {
+			name = segment.name
+		}
+		if name == "" {
+			name = segment.wxID
+		}
+		builder.WriteString("@" + name + mentionSeparator)
+		if _, ok = seen[segment.wxID]; !ok {
+			seen[segment.wxID] = struct{}{}
+			atList = append(atList, segment.wxID)
+		}
+	}
+	return builder.String(), atList
+}
+
+// NewMessageBuilder returns an empty MessageBuilder.
+func NewMessageBuilder() *MessageBuilder {
+	return &MessageBuilder{}
+}
+
+// SendMessage sends the message built by the builder to the group.
+func (g *Group) SendMessage(builder *MessageBuilder) error {
+	return g.Owner().sendMessage(g.Wxid, builder)
+}
+
+// sendMessage resolves the mentions from the members of the group and sends the message.
+func (a *Account) sendMessage(groupID string, builder *MessageBuilder) error {
+	if !builder.HasMention() {
+		content, _ := builder.Build(nil)
+		return a.sendText(groupID, content)
+	}
+	members, err := a.bot.client.GetChatRoomMembers(a.bot.Context(), groupID)
+	if err != nil {
+		return err
+	}
+	content, atList := builder.Build(members)
+	return a.sendAtText(groupID, content, atList)
+}
+
+// ReplyMention replies the text to the chat, and mentions the sender if it is a group message.
+func (m Message) ReplyMention(text string) error {
+	if !m.IsGroupMessage() {
+		return m.ReplyText(text)
+	}
+	builder := NewMessageBuilder().MentionID(m.SenderID(), "").Text(text)
+	return m.Owner().sendMessage(m.FromUser, builder)
+}
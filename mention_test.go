@@ -0,0 +1,31 @@
+package wxhelper
+
+import "testing"
+
+func TestMessageBuilder(t *testing.T) {
+	members := []*Profile{
+		{Wxid: "wxid_a", Nickname: "Alice", DisplayName: "产品-小A"},
+		{Wxid: "wxid_b", Nickname: "Bob"},
+	}
+	content, atList := NewMessageBuilder().
+		Text("请").
+		Mention(&Profile{Wxid: "wxid_a", Nickname: "Alice"}).
+		Text("和").
+		MentionID("wxid_b", "").
+		Text("看一下，").
+		MentionID("wxid_c", "Carol").
+		Mention(&Profile{Wxid: "wxid_a"}).
+		Build(members)
+	expected := "请@产品-小A\u2005和@Bob\u2005看一下，@Carol\u2005@产品-小A\u2005"
+	if content != expected {
+		t.Fatalf("expected %q, got %q", expected, content)
+	}
+	if len(atList) != 3 || atList[0] != "wxid_a" || atList[1] != "wxid_b" || atList[2] != "wxid_c" {
+		t.Fatalf("unexpected at list %v", atList)
+	}
+
+	content, atList = NewMessageBuilder().MentionAll().Text("开会了").Build(nil)
+	if content != "@所有人\u2005开会了" || len(atList) != 1 || atList[0] != "notify@all" {
+		t.Fatalf("unexpected content %q with at list %v", content, atList)
+	}
+}
@@ -7,6 +7,12 @@ import (
 	"strings"
 )
 
+// ErrNotGroupMessage is returned when a group message is required.
+var ErrNotGroupMessage = errors.New("not a group message")
+
+// ErrNotMediaMessage is returned by SaveMedia when the message carries no media.
+var ErrNotMediaMessage = errors.New("not a media message")
+
 type Message struct {
 	Content            string `json:"content"`
 	CreateTime         int    `json:"createTime"`
@@ -43,6 +49,14 @@ func (m Message) IsVoice() bool {
 	return m.Type == 34
 }
 
+func (m Message) IsAppMessage() bool {
+	return m.Type == 49
+}
+
+func (m Message) IsSystemMessage() bool {
+	return m.Type == 10000 || m.Type == 10002
+}
+
 func (m Message) IsAtMe() bool {
 	return strings.HasSuffix(m.DisplayFullContent, "在群聊中@了你")
 }
@@ -77,20 +91,123 @@ func (m Message) SaveImage(writer io.Writer) error {
 	return err
 }
 
+// SaveVoice writes the voice of the message in amr format to writer.
+func (m Message) SaveVoice(writer io.Writer) error {
+	if !m.IsVoice() {
+		return errors.New("not a voice message")
+	}
+	return m.downloadMedia(writer)
+}
+
+// SaveVideo writes the video of the message in mp4 format to writer.
+func (m Message) SaveVideo(writer io.Writer) error {
+	if !m.IsVideo() {
+		return errors.New("not a video message")
+	}
+	return m.downloadMedia(writer)
+}
+
+// SaveFile writes the file attachment of the message to writer.
+func (m Message) SaveFile(writer io.Writer) error {
+	if !m.IsFileAttachment() {
+		return errors.New("not a file message")
+	}
+	return m.downloadMedia(writer)
+}
+
+// SaveMedia writes the image, voice, video, file attachment or emoticon of the message to writer.
+func (m Message) SaveMedia(writer io.Writer) error {
+	switch {
+	case m.IsImage():
+		return m.SaveImage(writer)
+	case m.IsVoice(), m.IsVideo(), m.IsEmoticon(), m.IsFileAttachment():
+		return m.downloadMedia(writer)
+	default:
+		return ErrNotMediaMessage
+	}
+}
+
+func (m Message) downloadMedia(writer io.Writer) error {
+	bot := m.Owner().bot
+	return bot.client.DownloadMedia(bot.Context(), &m, writer)
+}
+
 func (m Message) ForwardTo(u *User) error {
 	return m.Owner().ForwardMessage(&m, u)
 }
 
+// SenderID returns the wxid of the user who sent the message.
+// For group messages it is the speaking member rather than the group.
+func (m Message) SenderID() string {
+	if m.IsGroupMessage() {
+		if sender, _, ok := splitGroupContent(m.Content); ok {
+			return sender
+		}
+	}
+	return m.FromUser
+}
+
+// Text returns the content without the "wxid:\n" sender prefix of group messages.
+func (m Message) Text() string {
+	if m.IsGroupMessage() {
+		_, text, _ := splitGroupContent(m.Content)
+		return text
+	}
+	return m.Content
+}
+
+// Sender returns the user who sent the message from the contact list.
+// The speaking member of a group may not be in the contact list, use GroupSender instead.
 func (m Message) Sender() (*User, error) {
-	members, err := m.Owner().bot.client.GetContactList(m.Owner().bot.Context())
+	sender, err := m.Owner().bot.contacts.Get(m.Owner().bot.Context(), m.SenderID())
+	if err != nil {
+		return nil, err
+	}
+	sender.owner = func() *Account { return m.Owner() }
+	return sender, nil
+}
+
+// GroupSender returns the speaking member of a group message, friend or not.
+func (m Message) GroupSender() (*Profile, error) {
+	if !m.IsGroupMessage() {
+		return nil, ErrNotGroupMessage
+	}
+	members, err := m.Owner().bot.client.GetChatRoomMembers(m.Owner().bot.Context(), m.FromUser)
 	if err != nil {
 		return nil, err
 	}
-	result := members.Search(1, func(user *User) bool { return user.Wxid == m.FromUser })
-	if len(result) == 0 {
-		return nil, ErrNoSuchUserFound
+	senderID := m.SenderID()
+	for _, member := range members {
+		if member.Wxid == senderID {
+			return member, nil
+		}
+	}
+	return nil, ErrNoSuchUserFound
+}
+
+// Chat returns the chat the message is sent in, which is the group for group messages
+// and the peer for private messages.
+func (m Message) Chat() (*User, error) {
+	owner := func() *Account { return m.Owner() }
+	chat, err := m.Owner().bot.contacts.Get(m.Owner().bot.Context(), m.FromUser)
+	if errors.Is(err, ErrNoSuchUserFound) {
+		// 不在通讯录中的群聊也可以发送消息
+		return &User{Wxid: m.FromUser, owner: owner}, nil
+	}
+	if err != nil {
+		return nil, err
 	}
-	return result[0], nil
+	chat.owner = owner
+	return chat, nil
 }
 
 type MessageHandler func(msg *Message)
+
+// splitGroupContent 拆分群消息的内容，群消息的内容形如 "wxid_xxx:\n你好"
+func splitGroupContent(content string) (sender, text string, ok bool) {
+	sender, text, ok = strings.Cut(content, ":\n")
+	if !ok || sender == "" || strings.ContainsAny(sender, " \n") {
+		return "", content, false
+	}
+	return sender, text, true
+}
@@ -0,0 +1,439 @@
+package wxhelper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/rs/zerolog/log"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrMessageNotFound is returned by MessageStore.Get when the message is not stored.
+var ErrMessageNotFound = errors.New("message not found")
+
+// MessageQuery 限定查询的时间范围和分页，零值表示不限制
+type MessageQuery struct {
+	// Since 包含该时间及之后的消息
+	Since time.Time
+	// Until 不包含该时间及之后的消息
+	Until time.Time
+	// Offset 跳过前 Offset 条满足条件的消息
+	Offset int
+	// Limit 最多返回的消息条数，小于等于 0 时不限制
+	Limit int
+}
+
+func (q MessageQuery) contains(msg *Message) bool {
+	createTime := time.Unix(int64(msg.CreateTime), 0)
+	if !q.Since.IsZero() && createTime.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !createTime.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// MessageStore 保存历史消息，消息按照写入的顺序返回
+type MessageStore interface {
+	// Append stores the message.
+	Append(ctx context.Context, msg *Message) error
+	// Get returns the message of the msgID.
+	Get(ctx context.Context, msgID int64) (*Message, error)
+	// List returns the messages of the chat, which is the group or the peer of a private chat.
+	List(ctx context.Context, chatID string, query MessageQuery) ([]*Message, error)
+	// Search returns the messages whose text contains the keyword.
+	// It searches all the chats if chatID is empty.
+	Search(ctx context.Context, chatID, keyword string, query MessageQuery) ([]*Message, error)
+}
+
+// messageChatID returns the chat of the message, the receiver for messages sent by the account.
+func messageChatID(msg *Message) string {
+	if msg.account != nil && msg.FromUser == msg.account.Wxid {
+		return msg.ToUser
+	}
+	return msg.FromUser
+}
+
+type messageRecord struct {
+	Chat    string   `json:"chat"`
+	Message *Message `json:"message"`
+	// Time 是写入的时间，旧版本的记录没有，使用消息的 CreateTime
+	Time time.Time `json:"time,omitempty"`
+}
+
+// MemoryMessageStore 将消息保存在内存中，进程退出后消息丢失
+type MemoryMessageStore struct {
+	mu      sync.RWMutex
+	records []*messageRecord
+	byID    map[int64]int
+	byChat  map[string][]int
+}
+
+func (s *MemoryMessageStore) Append(_ context.Context, msg *Message) error {
+	s.append(&messageRecord{Chat: messageChatID(msg), Message: msg})
+	return nil
+}
+
+func (s *MemoryMessageStore) append(record *messageRecord) {
+	clone := *record.Message
+	record.Message = &clone
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := len(s.records)
+	s.records = append(s.records, record)
+	// 发送的消息没有 MsgId
+	if clone.MsgId != 0 {
+		s.byID[clone.MsgId] = index
+	}
+	s.byChat[record.Chat] = append(s.byChat[record.Chat], index)
+}
+
+func (s *MemoryMessageStore) Get(_ context.Context, msgID int64) (*Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	index, ok := s.byID[msgID]
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+	clone := *s.records[index].Message
+	return &clone, nil
+}
+
+func (s *MemoryMessageStore) List(_ context.Context, chatID string, query MessageQuery) ([]*Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.collect(s.byChat[chatID], query, func(*Message) bool { return true }), nil
+}
+
+func (s *MemoryMessageStore) Search(_ context.Context, chatID, keyword string, query MessageQuery) ([]*Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	match := func(msg *Message) bool { return strings.Contains(msg.Text(), keyword) }
+	if chatID != "" {
+		return s.collect(s.byChat[chatID], query, match), nil
+	}
+	indexes := make([]int, len(s.records))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return s.collect(indexes, query, match), nil
+}
+
+// collect returns the copies of the matched messages in the query range, the caller must hold the lock.
+func (s *MemoryMessageStore) collect(indexes []int, query MessageQuery, match func(*Message) bool) []*Message {
+	var result []*Message
+	skipped := 0
+	for _, index := range indexes {
+		msg := s.records[index].Message
+		if !query.contains(msg) || !match(msg) {
+			continue
+		}
+		if skipped < query.Offset {
+			skipped++
+			continue
+		}
+		clone := *msg
+		result = append(result, &clone)
+		if query.Limit > 0 && len(result) >= query.Limit {
+			break
+		}
+	}
+	return result
+}
+
+// NewMemoryMessageStore returns a MessageStore that keeps messages in memory.
+func NewMemoryMessageStore() *MemoryMessageStore {
+	return &MemoryMessageStore{
+		byID:   make(map[int64]int),
+		byChat: make(map[string][]int),
+	}
+}
+
+const (
+	defaultMessageMaxAge   = 30 * 24 * time.Hour
+	defaultMessageMaxCount = 100000
+	// compactMinStale 是触发压缩文件的最少过期消息条数，过期消息占四分之一以上时也会压缩
+	compactMinStale = 1000
+)
+
+// fileRecord 是消息在文件中的位置，消息本身不保存在内存中
+type fileRecord struct {
+	offset     int64
+	length     int
+	createTime int
+	storedAt   time.Time
+}
+
+// FileMessageStore 将消息以 JSON Lines 的格式追加写入文件，内存中只保留消息在文件中的位置，查询时从文件中读取。
+// 超过 MaxAge 或者 MaxCount 的消息不再返回，并在写入时从文件中删除。
+// 恢复的消息没有关联的 Account，不能直接回复。
+type FileMessageStore struct {
+	// MaxAge 消息保留的时长，小于等于 0 时不限制，默认 30 天
+	MaxAge time.Duration
+	// MaxCount 最多保留的消息条数，超出时删除最早的消息，小于等于 0 时不限制，默认 100000 条
+	MaxCount int
+
+	mu      sync.RWMutex
+	path    string
+	file    *os.File
+	size    int64
+	records []fileRecord
+	byID    map[int64]int
+	byChat  map[string][]int
+}
+
+func (s *FileMessageStore) Append(_ context.Context, msg *Message) error {
+	record := &messageRecord{Chat: messageChatID(msg), Message: msg, Time: time.Now()}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.index(record, s.size, len(data)+1)
+	if stale := s.firstLive(); stale >= compactMinStale || stale > 0 && stale*4 >= len(s.records) {
+		// 消息已经写入，压缩失败时下次写入再重试
+		if err = s.compact(stale); err != nil {
+			log.Error().Err(err).Str("file", s.path).Msg("compact message file")
+		}
+	}
+	return nil
+}
+
+// index adds the record at the offset of the file, the caller must hold the lock.
+func (s *FileMessageStore) index(record *messageRecord, offset int64, length int) {
+	index := len(s.records)
+	storedAt := record.Time
+	if storedAt.IsZero() {
+		storedAt = time.Unix(int64(record.Message.CreateTime), 0)
+	}
+	s.records = append(s.records, fileRecord{
+		offset:     offset,
+		length:     length,
+		createTime: record.Message.CreateTime,
+		storedAt:   storedAt,
+	})
+	s.size = offset + int64(length)
+	// 发送的消息没有 MsgId
+	if record.Message.MsgId != 0 {
+		s.byID[record.Message.MsgId] = index
+	}
+	s.byChat[record.Chat] = append(s.byChat[record.Chat], index)
+}
+
+// firstLive returns the index of the first record within MaxAge and MaxCount,
+// the records before it are stale. The caller must hold the lock.
+func (s *FileMessageStore) firstLive() int {
+	first := 0
+	if s.MaxCount > 0 && len(s.records) > s.MaxCount {
+		first = len(s.records) - s.MaxCount
+	}
+	if s.MaxAge > 0 {
+		deadline := time.Now().Add(-s.MaxAge)
+		// 记录按照写入的顺序排列
+		expired := sort.Search(len(s.records), func(i int) bool { return s.records[i].storedAt.After(deadline) })
+		if expired > first {
+			first = expired
+		}
+	}
+	return first
+}
+
+// read reads the message of the record from the file, the caller must hold the lock.
+func (s *FileMessageStore) read(index int) (*Message, error) {
+	record := s.records[index]
+	data := make([]byte, record.length)
+	if _, err := s.file.ReadAt(data, record.offset); err != nil {
+		return nil, err
+	}
+	var stored messageRecord
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	return stored.Message, nil
+}
+
+func (s *FileMessageStore) Get(_ context.Context, msgID int64) (*Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	index, ok := s.byID[msgID]
+	if !ok || index < s.firstLive() {
+		return nil, ErrMessageNotFound
+	}
+	return s.read(index)
+}
+
+func (s *FileMessageStore) List(_ context.Context, chatID string, query MessageQuery) ([]*Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.collect(s.byChat[chatID], query, nil)
+}
+
+func (s *FileMessageStore) Search(_ context.Context, chatID, keyword string, query MessageQuery) ([]*Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	match := func(msg *Message) bool { return strings.Contains(msg.Text(), keyword) }
+	if chatID != "" {
+		return s.collect(s.byChat[chatID], query, match)
+	}
+	indexes := make([]int, len(s.records))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return s.collect(indexes, query, match)
+}
+
+// collect reads the live messages in the query range which match, the caller must hold the lock.
+// The messages are filtered by the time before reading if match is nil.
+func (s *FileMessageStore) collect(indexes []int, query MessageQuery, match func(*Message) bool) ([]*Message, error) {
+	var result []*Message
+	first := s.firstLive()
+	skipped := 0
+	for _, index := range indexes {
+		if index < first || !query.contains(&Message{CreateTime: s.records[index].createTime}) {
+			continue
+		}
+		if match == nil && skipped < query.Offset {
+			skipped++
+			continue
+		}
+		msg, err := s.read(index)
+		if err != nil {
+			return nil, err
+		}
+		if match != nil {
+			if !match(msg) {
+				continue
+			}
+			if skipped < query.Offset {
+				skipped++
+				continue
+			}
+		}
+		result = append(result, msg)
+		if query.Limit > 0 && len(result) >= query.Limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// Compact removes the messages beyond MaxAge and MaxCount from the file.
+// It is called by Append when enough messages are stale.
+func (s *FileMessageStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact(s.firstLive())
+}
+
+// compact rewrites the file without the records before first, the caller must hold the lock.
+func (s *FileMessageStore) compact(first int) error {
+	if first == 0 {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	var start int64
+	if first < len(s.records) {
+		start = s.records[first].offset
+	} else {
+		start = s.size
+	}
+	if _, err = io.Copy(tmp, io.NewSectionReader(s.file, start, s.size-start)); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	file, err := openMessageFile(s.path)
+	if err != nil {
+		return err
+	}
+	_ = s.file.Close()
+	s.file = file
+	return s.load()
+}
+
+// Close closes the underlying file.
+func (s *FileMessageStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// load rebuilds the index from the file, the caller must hold the lock.
+func (s *FileMessageStore) load() error {
+	s.records, s.size = nil, 0
+	s.byID = make(map[int64]int)
+	s.byChat = make(map[string][]int)
+	reader := bufio.NewReader(io.NewSectionReader(s.file, 0, math.MaxInt64))
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var record messageRecord
+			// 进程异常退出时最后一行可能不完整
+			if err := json.Unmarshal(line, &record); err != nil || record.Message == nil {
+				log.Warn().Err(err).Str("file", s.path).Msg("skip broken message record")
+			} else {
+				s.index(&record, offset, len(line))
+			}
+			offset += int64(len(line))
+			s.size = offset
+		}
+		if errors.Is(err, io.EOF) {
+			// 补全最后一行的换行符，避免新的记录拼接在不完整的行后面
+			if len(line) > 0 && line[len(line)-1] != '\n' {
+				_, err = s.file.Write([]byte{'\n'})
+				s.size++
+				return err
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func openMessageFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+}
+
+// OpenFileMessageStore opens or creates the file at path and indexes the stored messages.
+func OpenFileMessageStore(path string) (*FileMessageStore, error) {
+	file, err := openMessageFile(path)
+	if err != nil {
+		return nil, err
+	}
+	store := &FileMessageStore{
+		MaxAge:   defaultMessageMaxAge,
+		MaxCount: defaultMessageMaxCount,
+		path:     path,
+		file:     file,
+	}
+	if err = store.load(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return store, nil
+}
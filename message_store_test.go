@@ -0,0 +1,147 @@
+package wxhelper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileMessageStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	store, err := OpenFileMessageStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	messages := []*Message{
+		{MsgId: 1, FromUser: "123@chatroom", Content: "wxid_a:\n明天去爬山", CreateTime: 100},
+		{MsgId: 2, FromUser: "wxid_b", Content: "你好", CreateTime: 200},
+		{MsgId: 3, FromUser: "123@chatroom", Content: "wxid_b:\n爬山带水", CreateTime: 300},
+	}
+	for _, msg := range messages {
+		if err = store.Append(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟异常退出时写了一半的记录
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.WriteString(`{"chat":"wxid_b","mess`)
+	_ = file.Close()
+
+	store, err = OpenFileMessageStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err = store.Append(ctx, &Message{MsgId: 4, FromUser: "wxid_b", Content: "在吗", CreateTime: 400}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := store.Get(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Content != "你好" {
+		t.Fatalf("expected 你好, got %s", msg.Content)
+	}
+	if _, err = store.Get(ctx, 5); err != ErrMessageNotFound {
+		t.Fatalf("expected %v, got %v", ErrMessageNotFound, err)
+	}
+
+	list, err := store.List(ctx, "wxid_b", MessageQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].MsgId != 2 || list[1].MsgId != 4 {
+		t.Fatalf("unexpected messages %v", list)
+	}
+	list, _ = store.List(ctx, "123@chatroom", MessageQuery{Since: time.Unix(200, 0), Limit: 1})
+	if len(list) != 1 || list[0].MsgId != 3 {
+		t.Fatalf("unexpected messages %v", list)
+	}
+
+	found, err := store.Search(ctx, "", "爬山", MessageQuery{Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].SenderID() != "wxid_b" {
+		t.Fatalf("unexpected messages %v", found)
+	}
+}
+
+func TestFileMessageStoreRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	store, err := OpenFileMessageStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.MaxCount = 3
+	ctx := context.Background()
+	for i := 1; i <= 5; i++ {
+		if err = store.Append(ctx, &Message{MsgId: int64(i), FromUser: "wxid_a", Content: "hi", CreateTime: 100 * i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 只保留最新的 3 条消息
+	list, err := store.List(ctx, "wxid_a", MessageQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].MsgId != 3 || list[2].MsgId != 5 {
+		t.Fatalf("unexpected messages %v", list)
+	}
+	if _, err = store.Get(ctx, 1); err != ErrMessageNotFound {
+		t.Fatalf("expected %v, got %v", ErrMessageNotFound, err)
+	}
+	if err = store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 过期的消息已经从文件中删除
+	store, err = OpenFileMessageStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	store.MaxCount = 0
+	list, _ = store.List(ctx, "wxid_a", MessageQuery{})
+	if len(list) != 3 || list[0].MsgId != 3 {
+		t.Fatalf("unexpected messages %v", list)
+	}
+
+	store.MaxAge = time.Minute
+	// 模拟一个小时之前写入的消息
+	for i := range store.records {
+		store.records[i].storedAt = time.Now().Add(-time.Hour)
+	}
+	if err = store.Append(ctx, &Message{MsgId: 6, FromUser: "wxid_b", Content: "在吗", CreateTime: 600}); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ = store.List(ctx, "wxid_a", MessageQuery{}); len(list) != 0 {
+		t.Fatalf("expected the old messages to expire, got %v", list)
+	}
+	found, err := store.Search(ctx, "", "在吗", MessageQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].MsgId != 6 {
+		t.Fatalf("unexpected messages %v", found)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Fatalf("expected 1 line in the file, got %d", lines)
+	}
+}
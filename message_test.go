@@ -0,0 +1,50 @@
+package wxhelper
+
+import (
+	"bytes"
+	"github.com/eatmoreapple/wxhelper/wxtest"
+	"testing"
+	"time"
+)
+
+func TestSaveMedia(t *testing.T) {
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot"})
+	stack.AddVoice(1, []byte("voice"))
+	stack.AddVideo(2, "wxid_a", []byte("video"))
+	stack.AddFile(3, "wxid_a", "report.pdf", []byte("file"))
+
+	type saved struct {
+		data string
+		err  error
+	}
+	results := make(chan saved, 4)
+	bot := New(stack.URL)
+	bot.MessageHandler = func(msg *Message) {
+		var buf bytes.Buffer
+		err := msg.SaveMedia(&buf)
+		results <- saved{data: buf.String(), err: err}
+	}
+	t.Cleanup(bot.Stop)
+	go func() { _ = bot.Run() }()
+
+	messages := []*wxtest.Message{
+		{Type: 34, MsgId: 1, FromUser: "wxid_a", ToUser: "wxid_bot"},
+		{Type: 43, MsgId: 2, FromUser: "wxid_a", ToUser: "wxid_bot"},
+		{Type: 49, MsgId: 3, FromUser: "wxid_a", ToUser: "wxid_bot", Content: `<msg><appmsg><title>report.pdf</title><type>6</type></appmsg></msg>`},
+		{Type: 1, MsgId: 4, FromUser: "wxid_a", ToUser: "wxid_bot", Content: "text"},
+	}
+	expected := []saved{{data: "voice"}, {data: "video"}, {data: "file"}, {err: ErrNotMediaMessage}}
+	for i, msg := range messages {
+		if err := stack.Inject(msg); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case result := <-results:
+			if result != expected[i] {
+				t.Fatalf("expected %+v, got %+v", expected[i], result)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the message is not handled")
+		}
+	}
+}
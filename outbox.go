@@ -0,0 +1,424 @@
+package wxhelper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrOutboxItemNotFound is returned when the outbox item does not exist.
+var ErrOutboxItemNotFound = errors.New("outbox item not found")
+
+// OutboxStatus 是发件箱中消息的投递状态
+type OutboxStatus string
+
+const (
+	// OutboxPending means the item is waiting to be sent or retried.
+	OutboxPending OutboxStatus = "pending"
+	// OutboxSent means the item is sent, it is removed from the store right after.
+	OutboxSent OutboxStatus = "sent"
+	// OutboxDead means the item failed too many times or with a fatal error.
+	OutboxDead OutboxStatus = "dead"
+)
+
+// OutboxKind 是发件箱中消息的类型
+type OutboxKind string
+
+const (
+	OutboxText   OutboxKind = "text"
+	OutboxImage  OutboxKind = "image"
+	OutboxFile   OutboxKind = "file"
+	OutboxAtText OutboxKind = "atText"
+)
+
+// OutboxItem 是发件箱中的一条待发送消息
+type OutboxItem struct {
+	ID       string     `json:"id"`
+	Kind     OutboxKind `json:"kind"`
+	To       string     `json:"to"`
+	Content  string     `json:"content,omitempty"`
+	AtList   []string   `json:"atList,omitempty"`
+	Filename string     `json:"filename,omitempty"`
+	// Data is the content of the image or the file.
+	Data []byte `json:"data,omitempty"`
+
+	Status        OutboxStatus `json:"status"`
+	Attempts      int          `json:"attempts"`
+	LastError     string       `json:"lastError,omitempty"`
+	CreatedAt     time.Time    `json:"createdAt"`
+	UpdatedAt     time.Time    `json:"updatedAt"`
+	NextAttemptAt time.Time    `json:"nextAttemptAt"`
+}
+
+// done reports whether the item will not be sent any more.
+func (i *OutboxItem) done() bool {
+	return i.Status == OutboxSent || i.Status == OutboxDead
+}
+
+// NewOutboxText returns an item that sends the text to the user or group.
+func NewOutboxText(to, content string) *OutboxItem {
+	return &OutboxItem{Kind: OutboxText, To: to, Content: content}
+}
+
+// NewOutboxAtText returns an item that sends the text to the group and mentions the members.
+func NewOutboxAtText(groupID, content string, memberIDs ...string) *OutboxItem {
+	return &OutboxItem{Kind: OutboxAtText, To: groupID, Content: content, AtList: memberIDs}
+}
+
+// NewOutboxImage returns an item that sends the image, the filename should have a correct extension.
+func NewOutboxImage(to, filename string, data []byte) *OutboxItem {
+	return &OutboxItem{Kind: OutboxImage, To: to, Filename: filename, Data: data}
+}
+
+// NewOutboxFile returns an item that sends the file.
+func NewOutboxFile(to, filename string, data []byte) *OutboxItem {
+	return &OutboxItem{Kind: OutboxFile, To: to, Filename: filename, Data: data}
+}
+
+// OutboxStore 持久化发件箱中的消息
+type OutboxStore interface {
+	// Save inserts or updates the item.
+	Save(ctx context.Context, item *OutboxItem) error
+	// Get returns the item of the id.
+	Get(ctx context.Context, id string) (*OutboxItem, error)
+	// Due returns at most limit pending items whose NextAttemptAt is not after now,
+	// the earlier ones first.
+	Due(ctx context.Context, now time.Time, limit int) ([]*OutboxItem, error)
+	// Dead returns the dead items.
+	Dead(ctx context.Context) ([]*OutboxItem, error)
+	// Delete removes the item.
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryOutboxStore 将发件箱保存在内存中
+type MemoryOutboxStore struct {
+	mu    sync.RWMutex
+	items map[string]*OutboxItem
+}
+
+func (s *MemoryOutboxStore) Save(_ context.Context, item *OutboxItem) error {
+	clone := *item
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[item.ID] = &clone
+	return nil
+}
+
+func (s *MemoryOutboxStore) Get(_ context.Context, id string) (*OutboxItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	item, ok := s.items[id]
+	if !ok {
+		return nil, ErrOutboxItemNotFound
+	}
+	clone := *item
+	return &clone, nil
+}
+
+func (s *MemoryOutboxStore) Due(_ context.Context, now time.Time, limit int) ([]*OutboxItem, error) {
+	return s.filter(limit, func(item *OutboxItem) bool {
+		return item.Status == OutboxPending && !item.NextAttemptAt.After(now)
+	}), nil
+}
+
+func (s *MemoryOutboxStore) Dead(_ context.Context) ([]*OutboxItem, error) {
+	return s.filter(0, func(item *OutboxItem) bool { return item.Status == OutboxDead }), nil
+}
+
+func (s *MemoryOutboxStore) filter(limit int, match func(item *OutboxItem) bool) []*OutboxItem {
+	s.mu.RLock()
+	var result []*OutboxItem
+	for _, item := range s.items {
+		if match(item) {
+			clone := *item
+			result = append(result, &clone)
+		}
+	}
+	s.mu.RUnlock()
+	sortOutboxItems(result)
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+func (s *MemoryOutboxStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, id)
+	return nil
+}
+
+// NewMemoryOutboxStore returns an OutboxStore that keeps items in memory.
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{items: make(map[string]*OutboxItem)}
+}
+
+func sortOutboxItems(items []*OutboxItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].NextAttemptAt.Equal(items[j].NextAttemptAt) {
+			return items[i].NextAttemptAt.Before(items[j].NextAttemptAt)
+		}
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+}
+
+// DefaultOutboxRetryPolicy returns a policy that retries 5 times from 1s up to 1min.
+func DefaultOutboxRetryPolicy() *ReconnectPolicy {
+	policy := DefaultReconnectPolicy()
+	policy.MaxAttempts = 5
+	return policy
+}
+
+// Outbox 发件箱，消息先写入 Store，再由 Run 启动的 worker 投递，失败后按照 Retry 策略重试，
+// 超过重试次数或者遇到不可重试的错误的消息进入死信列表，发送成功的消息从 Store 中删除。
+// 同一个 Store 只能有一个 worker 在投递。
+type Outbox struct {
+	// Retry is the backoff between attempts, DefaultOutboxRetryPolicy is used if it is nil.
+	Retry *ReconnectPolicy
+	// PollInterval is the interval to check the due items, defaults to 1 second.
+	PollInterval time.Duration
+	// BatchSize is the max items delivered in one poll, defaults to 100.
+	BatchSize int
+
+	bot     *Bot
+	store   OutboxStore
+	wake    chan struct{}
+	mu      sync.Mutex
+	waiters map[string]chan outboxResult
+}
+
+// outboxResult 是通知 Send 的投递结果，err 是更新 Store 失败的错误
+type outboxResult struct {
+	item *OutboxItem
+	err  error
+}
+
+func (o *Outbox) retryPolicy() *ReconnectPolicy {
+	if o.Retry == nil {
+		return DefaultOutboxRetryPolicy()
+	}
+	return o.Retry
+}
+
+// Enqueue stores the item and returns its id without waiting for it to be sent.
+func (o *Outbox) Enqueue(ctx context.Context, item *OutboxItem) (string, error) {
+	if err := o.enqueue(ctx, uuid.New().String(), item); err != nil {
+		return "", err
+	}
+	return item.ID, nil
+}
+
+// Send enqueues the item and waits until it is sent or dead.
+// It returns the last error of the item if it is dead,
+// or the error of the Store if the result of the delivery cannot be saved.
+func (o *Outbox) Send(ctx context.Context, item *OutboxItem) error {
+	id := uuid.New().String()
+	result := make(chan outboxResult, 1)
+	// 在入队之前注册，避免投递太快错过通知
+	o.mu.Lock()
+	o.waiters[id] = result
+	o.mu.Unlock()
+	defer func() {
+		o.mu.Lock()
+		delete(o.waiters, id)
+		o.mu.Unlock()
+	}()
+	if err := o.enqueue(ctx, id, item); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case result := <-result:
+		if result.err != nil {
+			return fmt.Errorf("outbox item %s is %s but not saved: %w", id, result.item.Status, result.err)
+		}
+		if result.item.Status == OutboxDead {
+			return fmt.Errorf("outbox item %s is dead: %s", id, result.item.LastError)
+		}
+		return nil
+	}
+}
+
+func (o *Outbox) enqueue(ctx context.Context, id string, item *OutboxItem) error {
+	now := time.Now()
+	item.ID = id
+	item.Status = OutboxPending
+	item.Attempts = 0
+	item.LastError = ""
+	item.CreatedAt, item.UpdatedAt, item.NextAttemptAt = now, now, now
+	if err := o.store.Save(ctx, item); err != nil {
+		return err
+	}
+	o.notify()
+	return nil
+}
+
+// Status returns the item of the id with its delivery status.
+// The sent items are removed from the Store, ErrOutboxItemNotFound is returned for them.
+func (o *Outbox) Status(ctx context.Context, id string) (*OutboxItem, error) {
+	return o.store.Get(ctx, id)
+}
+
+// DeadLetters returns the items that will not be sent any more.
+func (o *Outbox) DeadLetters(ctx context.Context) ([]*OutboxItem, error) {
+	return o.store.Dead(ctx)
+}
+
+// Requeue puts the dead item back to the queue with its attempts reset.
+func (o *Outbox) Requeue(ctx context.Context, id string) error {
+	item, err := o.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if item.Status != OutboxDead {
+		return fmt.Errorf("outbox item %s is %s", id, item.Status)
+	}
+	item.Status = OutboxPending
+	item.Attempts = 0
+	item.UpdatedAt = time.Now()
+	item.NextAttemptAt = item.UpdatedAt
+	if err = o.store.Save(ctx, item); err != nil {
+		return err
+	}
+	o.notify()
+	return nil
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers the items until the context is done.
+func (o *Outbox) Run(ctx context.Context) error {
+	interval := o.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		o.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-o.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *Outbox) deliverDue(ctx context.Context) {
+	batchSize := o.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	items, err := o.store.Due(ctx, time.Now(), batchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("load due outbox items")
+		return
+	}
+	if len(items) == 0 {
+		return
+	}
+	// 没有登录的账号时不算作尝试，等待下一次轮询
+	account, err := o.bot.GetLoginAccount()
+	if err != nil {
+		log.Warn().Err(err).Msg("outbox waits for the login account")
+		return
+	}
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		o.finish(ctx, item, o.deliver(account, item))
+	}
+	// 可能还有更多到期的消息
+	if len(items) == batchSize {
+		o.notify()
+	}
+}
+
+func (o *Outbox) deliver(account *Account, item *OutboxItem) error {
+	switch item.Kind {
+	case OutboxText:
+		return account.sendText(item.To, item.Content)
+	case OutboxAtText:
+		return account.sendAtText(item.To, item.Content, item.AtList)
+	case OutboxImage:
+		return account.sendImage(item.To, &namedReader{Reader: bytes.NewReader(item.Data), name: item.Filename})
+	case OutboxFile:
+		return account.sendFile(item.To, &namedReader{Reader: bytes.NewReader(item.Data), name: item.Filename})
+	default:
+		return fmt.Errorf("unknown outbox item kind %q", item.Kind)
+	}
+}
+
+// finish updates the item with the result of the attempt.
+func (o *Outbox) finish(ctx context.Context, item *OutboxItem, err error) {
+	// 停止时中断的发送不算作一次尝试
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	now := time.Now()
+	item.UpdatedAt = now
+	if err == nil {
+		item.Status = OutboxSent
+		item.LastError = ""
+	} else {
+		policy := o.retryPolicy()
+		item.Attempts++
+		item.LastError = err.Error()
+		if !policy.retryable(err) || (policy.MaxAttempts > 0 && item.Attempts >= policy.MaxAttempts) {
+			item.Status = OutboxDead
+		} else {
+			item.NextAttemptAt = now.Add(policy.backoff(item.Attempts))
+		}
+	}
+	// 发送成功的消息直接删除，避免 Store 无限增长
+	if item.Status == OutboxSent {
+		err = o.store.Delete(ctx, item.ID)
+	} else {
+		err = o.store.Save(ctx, item)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("id", item.ID).Str("status", string(item.Status)).Msg("save outbox item")
+	}
+	// 保存失败的待重试消息仍然留在 Store 中，下次轮询时重新投递
+	if item.done() {
+		o.mu.Lock()
+		if waiter, ok := o.waiters[item.ID]; ok {
+			waiter <- outboxResult{item: item, err: err}
+			delete(o.waiters, item.ID)
+		}
+		o.mu.Unlock()
+	}
+}
+
+// NewOutbox returns an Outbox that sends the items with the login account of the bot.
+func NewOutbox(bot *Bot, store OutboxStore) *Outbox {
+	return &Outbox{
+		bot:     bot,
+		store:   store,
+		wake:    make(chan struct{}, 1),
+		waiters: make(map[string]chan outboxResult),
+	}
+}
+
+// namedReader 为内存中的数据提供文件名，上传图片时需要正确的文件名
+type namedReader struct {
+	*bytes.Reader
+	name string
+}
+
+func (r *namedReader) Name() string { return r.name }
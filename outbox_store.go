@@ -0,0 +1,191 @@
+package wxhelper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileOutboxStore 将发件箱中的每条消息保存为目录中的一个 JSON 文件，打开时从目录中恢复
+type FileOutboxStore struct {
+	*MemoryOutboxStore
+
+	dir string
+}
+
+func (s *FileOutboxStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *FileOutboxStore) Save(ctx context.Context, item *OutboxItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	// 先写入临时文件再重命名，避免进程退出时留下不完整的文件
+	tmp, err := os.CreateTemp(s.dir, item.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), s.path(item.ID)); err != nil {
+		return err
+	}
+	return s.MemoryOutboxStore.Save(ctx, item)
+}
+
+func (s *FileOutboxStore) Delete(ctx context.Context, id string) error {
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return s.MemoryOutboxStore.Delete(ctx, id)
+}
+
+// OpenFileOutboxStore opens or creates the directory and loads the stored items.
+func OpenFileOutboxStore(dir string) (*FileOutboxStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	store := &FileOutboxStore{MemoryOutboxStore: NewMemoryOutboxStore(), dir: dir}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var item OutboxItem
+		if err = json.Unmarshal(data, &item); err != nil {
+			return nil, err
+		}
+		store.items[item.ID] = &item
+	}
+	return store, nil
+}
+
+// RedisOutboxStore 将发件箱保存在 Redis 中，消息保存在 hash 中，
+// 待发送的消息和死信分别按照时间保存在两个 sorted set 中
+type RedisOutboxStore struct {
+	client  *redis.Client
+	items   string
+	pending string
+	dead    string
+}
+
+func (s *RedisOutboxStore) Save(ctx context.Context, item *OutboxItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.items, item.ID, data)
+		pipe.ZRem(ctx, s.pending, item.ID)
+		pipe.ZRem(ctx, s.dead, item.ID)
+		switch item.Status {
+		case OutboxPending:
+			pipe.ZAdd(ctx, s.pending, &redis.Z{Score: float64(item.NextAttemptAt.UnixMilli()), Member: item.ID})
+		case OutboxDead:
+			pipe.ZAdd(ctx, s.dead, &redis.Z{Score: float64(item.UpdatedAt.UnixMilli()), Member: item.ID})
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisOutboxStore) Get(ctx context.Context, id string) (*OutboxItem, error) {
+	data, err := s.client.HGet(ctx, s.items, id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrOutboxItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var item OutboxItem
+	if err = json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *RedisOutboxStore) Due(ctx context.Context, now time.Time, limit int) ([]*OutboxItem, error) {
+	ids, err := s.client.ZRangeByScore(ctx, s.pending, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	return s.load(ctx, ids)
+}
+
+func (s *RedisOutboxStore) Dead(ctx context.Context) ([]*OutboxItem, error) {
+	ids, err := s.client.ZRange(ctx, s.dead, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return s.load(ctx, ids)
+}
+
+func (s *RedisOutboxStore) load(ctx context.Context, ids []string) ([]*OutboxItem, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	values, err := s.client.HMGet(ctx, s.items, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*OutboxItem, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		// 已经被删除的消息
+		if !ok {
+			continue
+		}
+		var item OutboxItem
+		if err = json.Unmarshal([]byte(data), &item); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, nil
+}
+
+func (s *RedisOutboxStore) Delete(ctx context.Context, id string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, s.items, id)
+		pipe.ZRem(ctx, s.pending, id)
+		pipe.ZRem(ctx, s.dead, id)
+		return nil
+	})
+	return err
+}
+
+// NewRedisOutboxStore returns an OutboxStore backed by Redis, the keys start with the prefix.
+func NewRedisOutboxStore(client *redis.Client, prefix string) *RedisOutboxStore {
+	if prefix == "" {
+		prefix = "wechat:outbox"
+	}
+	prefix = strings.TrimSuffix(prefix, ":")
+	return &RedisOutboxStore{
+		client:  client,
+		items:   prefix + ":items",
+		pending: prefix + ":pending",
+		dead:    prefix + ":dead",
+	}
+}
@@ -0,0 +1,299 @@
+package wxhelper
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis 实现了 RedisOutboxStore 用到的命令
+type fakeRedis struct {
+	listener net.Listener
+	mu       sync.Mutex
+	hashes   map[string]map[string]string
+	zsets    map[string]map[string]float64
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{
+		listener: listener,
+		hashes:   make(map[string]map[string]string),
+		zsets:    make(map[string]map[string]float64),
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	reader := bufio.NewReader(conn)
+	var queued [][]string
+	inMulti := false
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "MULTI":
+			inMulti, queued = true, nil
+			reply = "+OK\r\n"
+		case "EXEC":
+			replies := make([]string, 0, len(queued))
+			for _, command := range queued {
+				replies = append(replies, r.exec(command))
+			}
+			inMulti = false
+			reply = fmt.Sprintf("*%d\r\n%s", len(replies), strings.Join(replies, ""))
+		default:
+			if inMulti {
+				queued = append(queued, args)
+				reply = "+QUEUED\r\n"
+			} else {
+				reply = r.exec(args)
+			}
+		}
+		if _, err = io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func (r *fakeRedis) exec(args []string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := ""
+	if len(args) > 1 {
+		key = args[1]
+	}
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "HSET":
+		hash := r.hashes[key]
+		if hash == nil {
+			hash = make(map[string]string)
+			r.hashes[key] = hash
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			hash[args[i]] = args[i+1]
+		}
+		return ":1\r\n"
+	case "HGET":
+		value, ok := r.hashes[key][args[2]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(value)
+	case "HMGET":
+		replies := make([]string, 0, len(args)-2)
+		for _, field := range args[2:] {
+			if value, ok := r.hashes[key][field]; ok {
+				replies = append(replies, bulk(value))
+			} else {
+				replies = append(replies, "$-1\r\n")
+			}
+		}
+		return fmt.Sprintf("*%d\r\n%s", len(replies), strings.Join(replies, ""))
+	case "HDEL":
+		for _, field := range args[2:] {
+			delete(r.hashes[key], field)
+		}
+		return ":1\r\n"
+	case "ZADD":
+		zset := r.zsets[key]
+		if zset == nil {
+			zset = make(map[string]float64)
+			r.zsets[key] = zset
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			score, _ := strconv.ParseFloat(args[i], 64)
+			zset[args[i+1]] = score
+		}
+		return ":1\r\n"
+	case "ZREM":
+		for _, member := range args[2:] {
+			delete(r.zsets[key], member)
+		}
+		return ":1\r\n"
+	case "ZRANGE":
+		return members(r.sorted(key, math.Inf(-1), math.Inf(1)))
+	case "ZRANGEBYSCORE":
+		result := r.sorted(key, parseScore(args[2]), parseScore(args[3]))
+		if len(args) == 7 && strings.ToUpper(args[4]) == "LIMIT" {
+			offset, _ := strconv.Atoi(args[5])
+			count, _ := strconv.Atoi(args[6])
+			result = result[min(offset, len(result)):]
+			if count >= 0 && count < len(result) {
+				result = result[:count]
+			}
+		}
+		return members(result)
+	default:
+		return "-ERR unknown command " + args[0] + "\r\n"
+	}
+}
+
+// sorted returns the members of the sorted set within the scores, the caller must hold the lock.
+func (r *fakeRedis) sorted(key string, low, high float64) []string {
+	var result []string
+	for member, score := range r.zsets[key] {
+		if score >= low && score <= high {
+			result = append(result, member)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		zset := r.zsets[key]
+		if zset[result[i]] != zset[result[j]] {
+			return zset[result[i]] < zset[result[j]]
+		}
+		return result[i] < result[j]
+	})
+	return result
+}
+
+func parseScore(s string) float64 {
+	switch s {
+	case "-inf":
+		return math.Inf(-1)
+	case "+inf", "inf":
+		return math.Inf(1)
+	}
+	score, _ := strconv.ParseFloat(s, 64)
+	return score
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func members(values []string) string {
+	replies := make([]string, 0, len(values))
+	for _, value := range values {
+		replies = append(replies, bulk(value))
+	}
+	return fmt.Sprintf("*%d\r\n%s", len(replies), strings.Join(replies, ""))
+}
+
+func TestRedisOutboxStore(t *testing.T) {
+	server := newFakeRedis(t)
+	client := redis.NewClient(&redis.Options{Addr: server.listener.Addr().String()})
+	t.Cleanup(func() { _ = client.Close() })
+	store := NewRedisOutboxStore(client, "test:outbox:")
+	ctx := context.Background()
+
+	now := time.Now()
+	first := &OutboxItem{ID: "1", Kind: OutboxText, To: "wxid_a", Content: "hello", Status: OutboxPending, CreatedAt: now, NextAttemptAt: now.Add(-time.Second)}
+	second := &OutboxItem{ID: "2", Kind: OutboxText, To: "wxid_a", Content: "world", Status: OutboxPending, CreatedAt: now, NextAttemptAt: now}
+	later := &OutboxItem{ID: "3", Kind: OutboxText, To: "wxid_b", Content: "later", Status: OutboxPending, CreatedAt: now, NextAttemptAt: now.Add(time.Hour)}
+	for _, item := range []*OutboxItem{later, second, first} {
+		if err := store.Save(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 到期的消息按照时间排序，并且受 limit 限制
+	due, err := store.Due(ctx, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 2 || due[0].ID != "1" || due[1].ID != "2" {
+		t.Fatalf("unexpected due items %v", due)
+	}
+	if due, _ = store.Due(ctx, now, 1); len(due) != 1 || due[0].ID != "1" {
+		t.Fatalf("unexpected due items %v", due)
+	}
+
+	// 变成死信之后不再到期
+	first.Status = OutboxDead
+	first.LastError = "failed"
+	first.UpdatedAt = now
+	if err = store.Save(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ = store.Due(ctx, now, 10); len(due) != 1 || due[0].ID != "2" {
+		t.Fatalf("unexpected due items %v", due)
+	}
+	dead, err := store.Dead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != "1" || dead[0].LastError != "failed" {
+		t.Fatalf("unexpected dead items %v", dead)
+	}
+
+	item, err := store.Get(ctx, "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Content != "later" || !item.NextAttemptAt.Equal(later.NextAttemptAt) {
+		t.Fatalf("unexpected item %+v", item)
+	}
+
+	// 删除之后所有的 key 中都不存在
+	for _, id := range []string{"1", "2", "3"} {
+		if err = store.Delete(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = store.Get(ctx, "2"); err != ErrOutboxItemNotFound {
+		t.Fatalf("expected %v, got %v", ErrOutboxItemNotFound, err)
+	}
+	if due, _ = store.Due(ctx, now.Add(2*time.Hour), 10); len(due) != 0 {
+		t.Fatalf("unexpected due items %v", due)
+	}
+	if dead, _ = store.Dead(ctx); len(dead) != 0 {
+		t.Fatalf("unexpected dead items %v", dead)
+	}
+}
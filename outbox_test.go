@@ -0,0 +1,123 @@
+package wxhelper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOutboxRetry(t *testing.T) {
+	var attempts atomic.Int32
+	var down atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"data":{"account":"bot","wxid":"wxid_bot"}}`))
+	})
+	mux.HandleFunc("/api/send-text", func(w http.ResponseWriter, r *http.Request) {
+		// 前两次发送失败
+		if attempts.Add(1) <= 2 || down.Load() {
+			_, _ = w.Write([]byte(`{"code":1,"msg":"inject server unavailable"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	store, err := OpenFileOutboxStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox := NewOutbox(New(server.URL), store)
+	outbox.Retry = &ReconnectPolicy{InitialInterval: time.Millisecond, MaxAttempts: 3}
+	outbox.PollInterval = time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() { _ = outbox.Run(ctx) }()
+
+	if err = outbox.Send(ctx, NewOutboxText("wxid_a", "hello")); err != nil {
+		t.Fatal(err)
+	}
+	if attempts.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts.Load())
+	}
+	// 发送成功的消息从 Store 中删除
+	if paths, _ := filepath.Glob(filepath.Join(store.dir, "*.json")); len(paths) != 0 {
+		t.Fatalf("expected the sent item to be deleted, got %v", paths)
+	}
+
+	// 第二条消息一直发送失败
+	down.Store(true)
+	id, err := outbox.Enqueue(ctx, NewOutboxText("wxid_a", "world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		item, err := outbox.Status(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Status == OutboxDead {
+			if item.Attempts != 3 || item.LastError != "inject server unavailable" {
+				t.Fatalf("unexpected item %+v", item)
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 重新打开后死信依然存在
+	reopened, err := OpenFileOutboxStore(store.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, err := reopened.Dead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != id {
+		t.Fatalf("unexpected dead letters %v", dead)
+	}
+}
+
+// failingOutboxStore 删除消息时返回错误
+type failingOutboxStore struct {
+	*MemoryOutboxStore
+}
+
+func (s failingOutboxStore) Delete(context.Context, string) error {
+	return errors.New("store unavailable")
+}
+
+func TestOutboxSendStoreError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"data":{"account":"bot","wxid":"wxid_bot"}}`))
+	})
+	mux.HandleFunc("/api/send-text", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	outbox := NewOutbox(New(server.URL), failingOutboxStore{NewMemoryOutboxStore()})
+	outbox.PollInterval = time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() { _ = outbox.Run(ctx) }()
+
+	// 投递之后保存失败时返回错误，而不是一直等待
+	err := outbox.Send(ctx, NewOutboxText("wxid_a", "hello"))
+	if err == nil || !strings.Contains(err.Error(), "store unavailable") {
+		t.Fatalf("expected the store error, got %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Send blocked until the context expired")
+	}
+}
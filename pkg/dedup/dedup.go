@@ -0,0 +1,134 @@
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store records the keys that have been seen.
+type Store interface {
+	// Add records the key, it reports false if the key is already recorded.
+	Add(ctx context.Context, key string) (bool, error)
+}
+
+type memoryEntry struct {
+	key      string
+	expireAt time.Time
+}
+
+// MemoryStore is a bounded LRU of the keys, the least recently seen keys are evicted first.
+type MemoryStore struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// Add implements Store.
+func (s *MemoryStore) Add(_ context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*memoryEntry)
+		if s.ttl <= 0 || now.Before(entry.expireAt) {
+			s.order.MoveToFront(element)
+			return false, nil
+		}
+		s.order.Remove(element)
+		delete(s.entries, key)
+	}
+	entry := &memoryEntry{key: key}
+	if s.ttl > 0 {
+		entry.expireAt = now.Add(s.ttl)
+	}
+	s.entries[key] = s.order.PushFront(entry)
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return true, nil
+}
+
+// NewMemoryStore returns a MemoryStore keeping at most size keys, the keys expire after ttl if ttl is positive.
+func NewMemoryStore(size int, ttl time.Duration) *MemoryStore {
+	if size <= 0 {
+		size = 1
+	}
+	return &MemoryStore{size: size, ttl: ttl, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// RedisStore records the keys in redis with a ttl, the keys survive restarts and are shared by processes.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// Add implements Store.
+func (s *RedisStore) Add(ctx context.Context, key string) (bool, error) {
+	return s.client.SetNX(ctx, s.prefix+key, 1, s.ttl).Result()
+}
+
+// Redis 中记录已经处理过的消息的 key 前缀。
+// APIServer 和 Bot 共用一个 redis 时必须使用不同的前缀，否则 APIServer 放入队列的消息都会被 Bot 当作重复的消息。
+const (
+	// APIServerPrefix is the prefix used by apiserver.Default.
+	APIServerPrefix = "wechat:message:seen:"
+	// BotPrefix is the default prefix of NewRedisStore, for the Bot.Deduplicator.
+	BotPrefix = "wechat:bot:seen:"
+)
+
+// NewRedisStore returns a RedisStore, the keys are prefixed with prefix and expire after ttl.
+// BotPrefix is used if prefix is empty.
+func NewRedisStore(client *redis.Client, prefix string, ttl time.Duration) *RedisStore {
+	if prefix == "" {
+		prefix = BotPrefix
+	}
+	return &RedisStore{client: client, prefix: prefix, ttl: ttl}
+}
+
+// Deduplicator filters the duplicate messages and counts the suppressed ones.
+type Deduplicator struct {
+	store      Store
+	suppressed atomic.Int64
+}
+
+// Duplicate reports whether the message has been seen, and records it if not.
+// Messages without msgID are never duplicate.
+func (d *Deduplicator) Duplicate(ctx context.Context, msgID int64, sequence int) (bool, error) {
+	if msgID == 0 {
+		return false, nil
+	}
+	added, err := d.store.Add(ctx, Key(msgID, sequence))
+	if err != nil {
+		return false, err
+	}
+	if !added {
+		d.suppressed.Add(1)
+	}
+	return !added, nil
+}
+
+// Suppressed returns the number of the duplicate messages.
+func (d *Deduplicator) Suppressed() int64 {
+	return d.suppressed.Load()
+}
+
+// New returns a Deduplicator backed by the store.
+func New(store Store) *Deduplicator {
+	return &Deduplicator{store: store}
+}
+
+// Key returns the key of the message, the sequence tells apart messages sharing the same msgID.
+func Key(msgID int64, sequence int) string {
+	return strconv.FormatInt(msgID, 10) + ":" + strconv.Itoa(sequence)
+}
@@ -0,0 +1,55 @@
+package dedup
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeduplicator(t *testing.T) {
+	ctx := context.Background()
+	d := New(NewMemoryStore(2, 0))
+	cases := []struct {
+		msgID     int64
+		sequence  int
+		duplicate bool
+	}{
+		{1, 0, false},
+		{1, 0, true},
+		// 同一个 MsgId 不同的 MsgSequence 不是重复消息
+		{1, 1, false},
+		{2, 0, false},
+		// 1:0 已经被淘汰
+		{1, 0, false},
+		{2, 0, true},
+		// 没有 MsgId 的消息不去重
+		{0, 0, false},
+		{0, 0, false},
+	}
+	for _, c := range cases {
+		duplicate, err := d.Duplicate(ctx, c.msgID, c.sequence)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if duplicate != c.duplicate {
+			t.Fatalf("%s: expected %v, got %v", Key(c.msgID, c.sequence), c.duplicate, duplicate)
+		}
+	}
+	if d.Suppressed() != 2 {
+		t.Fatalf("expected 2, got %d", d.Suppressed())
+	}
+}
+
+func TestMemoryStoreTTL(t *testing.T) {
+	store := NewMemoryStore(10, 10*time.Millisecond)
+	if added, _ := store.Add(context.Background(), "a"); !added {
+		t.Fatal("expected the key to be added")
+	}
+	if added, _ := store.Add(context.Background(), "a"); added {
+		t.Fatal("expected the key to be seen")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if added, _ := store.Add(context.Background(), "a"); !added {
+		t.Fatal("expected the key to be expired")
+	}
+}
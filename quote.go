@@ -0,0 +1,103 @@
+package wxhelper
+
+import (
+	"errors"
+	"github.com/eatmoreapple/wxhelper/apiclient"
+	"github.com/eatmoreapple/wxhelper/apiserver"
+)
+
+const (
+	// quoteExcerptLength 是降级为文本回复时引用内容的最大长度
+	quoteExcerptLength = 30
+	// quoteSeparator 是微信显示引用时使用的分隔线
+	quoteSeparator = "- - - - - - - - - - - - - - -"
+)
+
+// ReplyQuote replies the text by quoting the message.
+// If the apiserver or the inject server does not support quoting, it replies a text
+// with an excerpt of the message instead. Other errors are returned without the fallback,
+// since the quote may have been delivered.
+func (m Message) ReplyQuote(text string) error {
+	owner := m.Owner()
+	// 降级为文本回复仍然是同一条回复，只等待一次 RateLimiter
+	if err := owner.bot.waitSend(m.FromUser); err != nil {
+		return err
+	}
+	name := m.senderName()
+	err := owner.sendQuote(&m, name, text)
+	if !errors.Is(err, apiclient.ErrUnsupported) {
+		return err
+	}
+	return owner.postText(m.FromUser, "「"+name+"："+m.excerpt()+"」\n"+quoteSeparator+"\n"+text)
+}
+
+// senderName returns the group display name or the nickname of the sender, or the wxid if not found.
+func (m Message) senderName() string {
+	if m.IsGroupMessage() {
+		if profile, err := m.GroupSender(); err == nil {
+			if profile.DisplayName != "" {
+				return profile.DisplayName
+			}
+			if profile.Nickname != "" {
+				return profile.Nickname
+			}
+		}
+		return m.SenderID()
+	}
+	if sender, err := m.Sender(); err == nil && sender.Nickname != "" {
+		return sender.Nickname
+	}
+	return m.SenderID()
+}
+
+// excerpt returns the beginning of the text, or a placeholder of the message type.
+func (m Message) excerpt() string {
+	switch {
+	case m.IsText():
+		text := []rune(m.Text())
+		if len(text) > quoteExcerptLength {
+			return string(text[:quoteExcerptLength]) + "…"
+		}
+		return string(text)
+	case m.IsImage():
+		return "[图片]"
+	case m.IsVoice():
+		return "[语音]"
+	case m.IsVideo():
+		return "[视频]"
+	case m.IsEmoticon():
+		return "[动画表情]"
+	}
+	if app, err := m.AppMessage(); err == nil {
+		switch app := app.(type) {
+		case *FileAttachment:
+			return "[文件]" + app.Name
+		case *LinkShare:
+			return "[链接]" + app.Title
+		}
+	}
+	return "[消息]"
+}
+
+// sendQuote sends the text quoting the message, the senderName is displayed in the quote.
+// The caller must wait for the RateLimiter.
+func (a *Account) sendQuote(quoted *Message, senderName, text string) error {
+	to := quoted.FromUser
+	req := apiserver.SendQuoteRequest{
+		To:            to,
+		Content:       text,
+		MsgID:         quoted.MsgId,
+		SenderName:    senderName,
+		QuotedType:    quoted.Type,
+		QuotedContent: quoted.Text(),
+		QuotedTime:    int64(quoted.CreateTime),
+	}
+	if quoted.IsGroupMessage() {
+		req.SenderID = quoted.SenderID()
+	}
+	if err := a.bot.client.SendQuote(a.bot.Context(), req); err != nil {
+		return err
+	}
+	a.storeSent(&Message{ToUser: to, Type: 1, Content: text})
+	return nil
+}
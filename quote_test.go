@@ -0,0 +1,84 @@
+package wxhelper
+
+import (
+	"context"
+	"errors"
+	"github.com/eatmoreapple/wxhelper/apiclient"
+	"github.com/eatmoreapple/wxhelper/wxtest"
+	"testing"
+	"time"
+)
+
+func TestReplyQuote(t *testing.T) {
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot"})
+	stack.AddFriend("wxid_a", "Alice")
+	bot := New(stack.URL)
+	bot.RateLimiter = &RateLimiter{}
+	bot.MessageHandler = func(msg *Message) { _ = msg.ReplyQuote("收到") }
+	t.Cleanup(bot.Stop)
+	go func() { _ = bot.Run() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := stack.Inject(&wxtest.Message{Type: 1, MsgId: 42, FromUser: "wxid_a", ToUser: "wxid_bot", Content: "明天下午三点开会"}); err != nil {
+		t.Fatal(err)
+	}
+	sent, err := stack.WaitSent(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := ParseAppMessage(sent[0].Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote, ok := app.(*QuoteReply)
+	if sent[0].Kind != wxtest.SentApp || !ok || quote.Content != "收到" || quote.Refer.MsgId != 42 ||
+		quote.Refer.DisplayName != "Alice" || quote.Refer.Content != "明天下午三点开会" {
+		t.Fatalf("unexpected quote %+v", sent[0])
+	}
+
+	// 注入服务器不支持时降级为文本回复
+	stack.Unsupported("/api/sendAppMsg")
+	if err = stack.Inject(&wxtest.Message{Type: 3, MsgId: 43, FromUser: "wxid_a", ToUser: "wxid_bot"}); err != nil {
+		t.Fatal(err)
+	}
+	if sent, err = stack.WaitSent(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	expected := "「Alice：[图片]」\n" + quoteSeparator + "\n收到"
+	if sent[1].Kind != wxtest.SentText || sent[1].Content != expected {
+		t.Fatalf("unexpected reply %+v", sent[1])
+	}
+	// 降级的文本回复和引用回复一样只等待一次
+	if stats := bot.RateLimiter.Stats(); stats.Sent != 2 {
+		t.Fatalf("expected 2 sends, got %d", stats.Sent)
+	}
+}
+
+func TestReplyQuoteSendFailed(t *testing.T) {
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot"})
+	stack.AddFriend("wxid_a", "Alice")
+	// 注入服务器有接口但是发送失败，引用消息可能已经发出，不能再降级为文本回复
+	stack.Fail("/api/sendAppMsg")
+	bot := New(stack.URL)
+	replied := make(chan error, 1)
+	bot.MessageHandler = func(msg *Message) { replied <- msg.ReplyQuote("收到") }
+	t.Cleanup(bot.Stop)
+	go func() { _ = bot.Run() }()
+
+	if err := stack.Inject(&wxtest.Message{Type: 1, MsgId: 42, FromUser: "wxid_a", ToUser: "wxid_bot", Content: "明天下午三点开会"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-replied:
+		var resultErr *apiclient.ResultError
+		if !errors.As(err, &resultErr) {
+			t.Fatalf("expected a result error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message is not handled")
+	}
+	if sent := stack.Sent(); len(sent) != 0 {
+		t.Fatalf("expected no fallback reply, got %+v", sent)
+	}
+}
@@ -0,0 +1,172 @@
+package wxhelper
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cleanupThreshold 记录的接收者超过这个数量时清理过期的记录
+const cleanupThreshold = 1024
+
+// RateLimiterStats 是 RateLimiter 的统计数据
+type RateLimiterStats struct {
+	// Waiting is the number of sends waiting for their turn.
+	Waiting int
+	// Sent is the number of sends allowed.
+	Sent uint64
+	// Delayed is the number of sends that had to wait.
+	Delayed uint64
+	// TotalDelay is the total time the sends waited, including the jitter.
+	TotalDelay time.Duration
+}
+
+// RateLimiter 限制发送消息的频率，避免账号因为发送过快触发风控。
+// 零值的字段表示不限制，所有的限制同时生效。
+type RateLimiter struct {
+	// Rate is the sends per second of the account.
+	Rate float64
+	// Burst is the sends allowed at once regardless of Rate, defaults to 1.
+	Burst int
+	// RecipientInterval is the minimal interval between two sends to the same recipient.
+	RecipientInterval time.Duration
+	// GroupBurst is the sends allowed to the same group within GroupWindow.
+	GroupBurst int
+	// GroupWindow is the time window of GroupBurst.
+	GroupWindow time.Duration
+	// Jitter adds a random delay in [0, Jitter) to every send, so that it looks like a human.
+	Jitter time.Duration
+
+	mu         sync.Mutex
+	tat        time.Time
+	recipients map[string]time.Time
+	groups     map[string][]time.Time
+	stats      RateLimiterStats
+}
+
+// Wait blocks until the send to the recipient is allowed or the context is done.
+func (l *RateLimiter) Wait(ctx context.Context, to string) error {
+	now := time.Now()
+	at := l.reserve(now, to)
+	if l.Jitter > 0 {
+		at = at.Add(time.Duration(rand.Int63n(int64(l.Jitter))))
+	}
+	delay := at.Sub(now)
+	if delay <= 0 {
+		l.done(0)
+		return nil
+	}
+	l.mu.Lock()
+	l.stats.Waiting++
+	l.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.stats.Waiting--
+		l.mu.Unlock()
+		return context.Cause(ctx)
+	case <-timer.C:
+		l.mu.Lock()
+		l.stats.Waiting--
+		l.mu.Unlock()
+		l.done(delay)
+		return nil
+	}
+}
+
+func (l *RateLimiter) done(delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Sent++
+	if delay > 0 {
+		l.stats.Delayed++
+		l.stats.TotalDelay += delay
+	}
+}
+
+// reserve returns the earliest time the send is allowed and takes the quota at that time.
+// The quota is not returned if the waiting is canceled.
+func (l *RateLimiter) reserve(now time.Time, to string) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.recipients == nil {
+		l.recipients = make(map[string]time.Time)
+		l.groups = make(map[string][]time.Time)
+	}
+	l.cleanup(now)
+
+	at := now
+	// 全局限速使用 GCRA 算法，tat 是理论上下一次发送的时间
+	var interval time.Duration
+	if l.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / l.Rate)
+		burst := l.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		if earliest := l.tat.Add(-interval * time.Duration(burst-1)); earliest.After(at) {
+			at = earliest
+		}
+	}
+	if next, ok := l.recipients[to]; ok && next.After(at) {
+		at = next
+	}
+	isGroup := strings.HasSuffix(to, "@chatroom")
+	if isGroup && l.GroupBurst > 0 && l.GroupWindow > 0 {
+		if sent := l.groups[to]; len(sent) >= l.GroupBurst {
+			if earliest := sent[len(sent)-l.GroupBurst].Add(l.GroupWindow); earliest.After(at) {
+				at = earliest
+			}
+		}
+	}
+
+	if l.Rate > 0 {
+		if l.tat.Before(at) {
+			l.tat = at
+		}
+		l.tat = l.tat.Add(interval)
+	}
+	if l.RecipientInterval > 0 {
+		l.recipients[to] = at.Add(l.RecipientInterval)
+	}
+	if isGroup && l.GroupBurst > 0 && l.GroupWindow > 0 {
+		sent := append(l.groups[to], at)
+		sort.Slice(sent, func(i, j int) bool { return sent[i].Before(sent[j]) })
+		if len(sent) > l.GroupBurst {
+			sent = sent[len(sent)-l.GroupBurst:]
+		}
+		l.groups[to] = sent
+	}
+	return at
+}
+
+// cleanup removes the expired records of the recipients, the caller must hold the lock.
+func (l *RateLimiter) cleanup(now time.Time) {
+	if len(l.recipients) > cleanupThreshold {
+		for to, next := range l.recipients {
+			if next.Before(now) {
+				delete(l.recipients, to)
+			}
+		}
+	}
+	if len(l.groups) > cleanupThreshold {
+		for to, sent := range l.groups {
+			if sent[len(sent)-1].Add(l.GroupWindow).Before(now) {
+				delete(l.groups, to)
+			}
+		}
+	}
+}
+
+// Stats returns the statistics of the limiter.
+func (l *RateLimiter) Stats() RateLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
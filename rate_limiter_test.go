@@ -0,0 +1,46 @@
+package wxhelper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	limiter := &RateLimiter{Rate: 10, Burst: 2, RecipientInterval: time.Second, GroupBurst: 2, GroupWindow: time.Minute}
+	now := time.Now()
+	expect := func(to string, delay time.Duration) {
+		t.Helper()
+		if at := limiter.reserve(now, to); at.Sub(now) != delay {
+			t.Fatalf("%s: expected %s, got %s", to, delay, at.Sub(now))
+		}
+	}
+	// 全局限速允许两条消息同时发送
+	expect("wxid_a", 0)
+	expect("wxid_b", 0)
+	expect("wxid_c", 100*time.Millisecond)
+	// 同一个接收者至少间隔一秒
+	expect("wxid_a", time.Second)
+	// 已经预留的发送也占用全局的额度
+	expect("123@chatroom", time.Second)
+	expect("123@chatroom", 2*time.Second)
+	// 同一个群一分钟内最多两条
+	expect("123@chatroom", time.Minute+time.Second)
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	limiter := &RateLimiter{RecipientInterval: time.Hour}
+	if err := limiter.Wait(context.Background(), "wxid_a"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, "wxid_a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	stats := limiter.Stats()
+	if stats.Sent != 1 || stats.Waiting != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
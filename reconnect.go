@@ -0,0 +1,135 @@
+package wxhelper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eatmoreapple/wxhelper/apiclient"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// maxBackoff 是没有设置 MaxInterval 时重连间隔的上限，避免指数增长溢出
+const maxBackoff = 24 * time.Hour
+
+// ReconnectPolicy 消息同步失败后的重连策略
+type ReconnectPolicy struct {
+	// InitialInterval is the delay before the first reconnection.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between reconnections, 0 means maxBackoff.
+	MaxInterval time.Duration
+	// Multiplier is the factor the delay grows by after each failed attempt.
+	Multiplier float64
+	// Jitter randomizes the delay by ±Jitter of it, between 0 and 1.
+	Jitter float64
+	// MaxAttempts limits the reconnections of one disconnection, 0 means unlimited.
+	MaxAttempts int
+	// Retryable reports whether the error is worth a reconnection.
+	// IsRetryableError is used if it is nil.
+	Retryable func(err error) bool
+}
+
+// DefaultReconnectPolicy returns a policy that retries forever from 1s up to 1min.
+func DefaultReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		InitialInterval: time.Second,
+		MaxInterval:     time.Minute,
+		Multiplier:      2,
+		Jitter:          0.2,
+	}
+}
+
+func (p *ReconnectPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryableError(err)
+}
+
+// backoff returns the delay before the given attempt which starts from 1.
+func (p *ReconnectPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	limit := float64(maxBackoff)
+	if p.MaxInterval > 0 {
+		limit = float64(p.MaxInterval)
+	}
+	// 多次重连之后 delay 可能是 +Inf，转换成 time.Duration 之前先限制
+	delay := math.Min(float64(p.InitialInterval)*math.Pow(multiplier, float64(attempt-1)), limit)
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(delay)
+}
+
+// IsRetryableError reports whether the error is transient: a network failure, a timeout,
+// a 5xx, 408 or 429 status, or a failed result of the apiserver such as an unreachable inject server.
+// Logout, not login, unsupported, 4xx, malformed responses and unknown errors are fatal.
+func IsRetryableError(err error) bool {
+	var (
+		statusErr *apiclient.StatusError
+		resultErr *apiclient.ResultError
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		netErr    net.Error
+	)
+	switch {
+	case err == nil:
+		return false
+	case IsLogoutError(err),
+		errors.Is(err, ErrBotStopped),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, apiclient.ErrUnsupported):
+		return false
+	case errors.As(err, &statusErr):
+		// 网关错误和限流可以重试，其余 4xx 重试也不会成功
+		code := statusErr.StatusCode
+		return code >= http.StatusInternalServerError ||
+			code == http.StatusRequestTimeout ||
+			code == http.StatusTooManyRequests
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return false
+	case errors.As(err, &resultErr),
+		errors.As(err, &netErr),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	default:
+		return false
+	}
+}
+
+// reconnect waits and fetches the login account again until it succeeds,
+// the error is fatal or the policy gives up.
+func (b *Bot) reconnect(policy *ReconnectPolicy) (*Account, error) {
+	var lastErr error
+	for attempt := 1; policy.MaxAttempts <= 0 || attempt <= policy.MaxAttempts; attempt++ {
+		timer := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-b.syncCtx.Done():
+			timer.Stop()
+			return nil, context.Cause(b.syncCtx)
+		case <-timer.C:
+		}
+		account, err := b.GetLoginAccount()
+		if err == nil {
+			return account, nil
+		}
+		if b.syncCtx.Err() != nil {
+			return nil, context.Cause(b.syncCtx)
+		}
+		if !policy.retryable(err) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("reconnect failed after %d attempts: %w", policy.MaxAttempts, lastErr)
+}
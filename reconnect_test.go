@@ -0,0 +1,184 @@
+package wxhelper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eatmoreapple/wxhelper/apiclient"
+	"github.com/eatmoreapple/wxhelper/apiserver"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReconnectBackoff(t *testing.T) {
+	policy := &ReconnectPolicy{InitialInterval: time.Second, MaxInterval: 5 * time.Second, Multiplier: 2}
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if delay := policy.backoff(attempt + 1); delay != expected {
+			t.Fatalf("attempt %d: expected %s, got %s", attempt+1, expected, delay)
+		}
+	}
+	// 没有上限时多次重连也不会溢出
+	policy.MaxInterval = 0
+	if delay := policy.backoff(10000); delay != maxBackoff {
+		t.Fatalf("expected %s, got %s", maxBackoff, delay)
+	}
+	policy.MaxInterval = 5 * time.Second
+	// 抖动不超过 ±Jitter
+	policy.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if delay := policy.backoff(1); delay < 800*time.Millisecond || delay > 1200*time.Millisecond {
+			t.Fatalf("expected 800ms to 1.2s, got %s", delay)
+		}
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	var syntaxErr *json.SyntaxError
+	if err := json.Unmarshal([]byte("<html>"), &struct{}{}); !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected a syntax error, got %v", err)
+	}
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{nil, false},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{fmt.Errorf("sync: %w", io.ErrUnexpectedEOF), true},
+		{context.DeadlineExceeded, true},
+		{&apiclient.StatusError{StatusCode: http.StatusBadGateway}, true},
+		{&apiclient.StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{&apiclient.ResultError{Code: 1, Msg: "inject server unreachable"}, true},
+		{&apiclient.StatusError{StatusCode: http.StatusBadRequest}, false},
+		{syntaxErr, false},
+		{apiclient.ErrAuth, false},
+		{ErrNotLogin, false},
+		{apiclient.ErrUnsupported, false},
+		{ErrBotStopped, false},
+		{context.Canceled, false},
+		{errors.New("unknown"), false},
+	}
+	for _, c := range cases {
+		if got := IsRetryableError(c.err); got != c.retryable {
+			t.Fatalf("%v: expected %v, got %v", c.err, c.retryable, got)
+		}
+	}
+}
+
+func TestRetryInitialLogin(t *testing.T) {
+	var attempts atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiserver.GetUserInfo, func(w http.ResponseWriter, r *http.Request) {
+		// APIServer 还没有启动完成
+		if attempts.Add(1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"data":{"account":"bot","wxid":"wxid_bot"}}`))
+	})
+	mux.HandleFunc(apiserver.SyncMessage, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	bot := New(server.URL)
+	bot.Reconnect = &ReconnectPolicy{InitialInterval: time.Millisecond, Multiplier: 1}
+	login := make(chan *Account, 1)
+	bot.OnLogin = func(account *Account) { login <- account }
+	var errs atomic.Int32
+	bot.OnError = func(err error) { errs.Add(1) }
+	t.Cleanup(bot.Stop)
+	go func() { _ = bot.Run() }()
+	select {
+	case account := <-login:
+		if account.Wxid != "wxid_bot" {
+			t.Fatalf("expected wxid_bot, got %s", account.Wxid)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the bot did not log in")
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Fatalf("expected 3 attempts, got %d", n)
+	}
+	if n := errs.Load(); n != 1 {
+		t.Fatalf("expected 1 error, got %d", n)
+	}
+
+	// 不可恢复的错误不重试
+	mux = http.NewServeMux()
+	mux.HandleFunc(apiserver.GetUserInfo, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	forbidden := httptest.NewServer(mux)
+	t.Cleanup(forbidden.Close)
+	bot = New(forbidden.URL)
+	bot.Reconnect = &ReconnectPolicy{InitialInterval: time.Millisecond}
+	var statusErr *apiclient.StatusError
+	if err := bot.Run(); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %v", err)
+	}
+
+	// apiserver 以 401 返回登录失效的结果
+	mux = http.NewServeMux()
+	mux.HandleFunc(apiserver.GetUserInfo, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"code":2,"msg":"not login"}`))
+	})
+	unauthorized := httptest.NewServer(mux)
+	t.Cleanup(unauthorized.Close)
+	bot = New(unauthorized.URL)
+	bot.Reconnect = &ReconnectPolicy{InitialInterval: time.Millisecond}
+	if err := bot.Run(); !errors.Is(err, apiclient.ErrAuth) {
+		t.Fatalf("expected %v, got %v", apiclient.ErrAuth, err)
+	}
+}
+
+func TestJSONGatewayError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiserver.GetUserInfo, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"data":{"account":"bot","wxid":"wxid_bot"}}`))
+	})
+	// 网关返回的 JSON 错误页面没有 code 字段，不能当作成功
+	mux.HandleFunc(apiserver.SyncMessage, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(`{"message":"upstream connect error"}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	bot := New(server.URL)
+	var statusErr *apiclient.StatusError
+	err := bot.Run()
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected status 502, got %v", err)
+	}
+	if !IsRetryableError(err) {
+		t.Fatalf("expected %v to be retryable", err)
+	}
+}
+
+func TestStopDuringLogin(t *testing.T) {
+	requested := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiserver.GetUserInfo, func(w http.ResponseWriter, r *http.Request) {
+		close(requested)
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	bot := New(server.URL)
+	go func() {
+		<-requested
+		bot.Stop()
+	}()
+	if err := bot.Run(); !errors.Is(err, ErrBotStopped) {
+		t.Fatalf("expected %v, got %v", ErrBotStopped, err)
+	}
+}
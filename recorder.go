@@ -0,0 +1,81 @@
+package wxhelper
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordedMessage 是录制文件中的一行，Time 是 Bot 同步到消息的时间
+type RecordedMessage struct {
+	Time    time.Time `json:"time"`
+	Message *Message  `json:"message"`
+}
+
+// MessageRecorder 把 Bot 同步到的原始消息按顺序写成 JSONL，用于之后通过 Replayer 回放
+type MessageRecorder struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer
+}
+
+// Record writes the message with the current time.
+func (r *MessageRecorder) Record(msg *Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enc.Encode(&RecordedMessage{Time: time.Now(), Message: msg})
+}
+
+// Close closes the underlying file if the recorder is created by CreateMessageRecorder.
+func (r *MessageRecorder) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// NewMessageRecorder returns a MessageRecorder writing to w.
+func NewMessageRecorder(w io.Writer) *MessageRecorder {
+	return &MessageRecorder{enc: json.NewEncoder(w)}
+}
+
+// CreateMessageRecorder returns a MessageRecorder appending to the file of the path.
+func CreateMessageRecorder(path string) (*MessageRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	recorder := NewMessageRecorder(file)
+	recorder.closer = file
+	return recorder, nil
+}
+
+// ReadRecordedMessages reads the messages written by a MessageRecorder.
+// A broken line, usually the last line of a crashed process, is skipped.
+func ReadRecordedMessages(r io.Reader) ([]*RecordedMessage, error) {
+	var messages []*RecordedMessage
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record RecordedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.Message == nil {
+			continue
+		}
+		messages = append(messages, &record)
+	}
+	return messages, scanner.Err()
+}
+
+// recordMessage writes the message to the Recorder if set.
+func (b *Bot) recordMessage(msg *Message) {
+	if b.Recorder == nil {
+		return
+	}
+	if err := b.Recorder.Record(msg); err != nil {
+		log.Error().Err(err).Int64("msgId", msg.MsgId).Msg("record message")
+	}
+}
@@ -0,0 +1,243 @@
+package wxhelper
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/eatmoreapple/wxhelper/apiserver"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CapturedSend 是回放时 Bot 发出的请求，请求不会被执行
+type CapturedSend struct {
+	// Route 是请求的 apiserver 接口，例如 apiserver.SendText
+	Route   string
+	To      string
+	Content string
+	// WxIDs 是 @ 的成员或者拉进群、移出群的成员
+	WxIDs []string
+	// File 是发送的图片或者文件的文件名
+	File  string
+	MsgID string
+	Time  time.Time
+}
+
+// Replayer 把 MessageRecorder 录制的消息重新交给 Bot 处理，用于复现线上的问题。
+// 回放时 Bot 连接的是一个本地的假 APIServer，发送消息等操作只会被记录下来。
+type Replayer struct {
+	// Speed 是回放的倍速，1 按照录制时的间隔回放，小于等于 0 时不等待
+	Speed float64
+	// Account 是回放时登录的账号，为 nil 时使用第一条消息的接收者
+	Account *Account
+	// Contacts 是回放时的联系人列表
+	Contacts Members
+	// GroupMembers 是回放时群的成员
+	GroupMembers map[string][]*Profile
+
+	messages []*RecordedMessage
+}
+
+// Replay creates a Bot, lets configure set it up, and feeds the recorded messages to it.
+// It returns the captured sends after all the messages are handled.
+func (r *Replayer) Replay(configure func(bot *Bot)) ([]*CapturedSend, error) {
+	srv := newReplayServer(r)
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	bot := New(server.URL)
+	if configure != nil {
+		configure(bot)
+	}
+	go func() { _ = bot.Run() }()
+	select {
+	case <-srv.exhausted:
+	case <-bot.Done():
+		return srv.captured(), bot.Err()
+	}
+	// 所有消息都已经交给了 Dispatcher，等待正在执行的 MessageHandler 结束
+	if err := bot.Shutdown(context.Background()); err != nil {
+		return srv.captured(), err
+	}
+	return srv.captured(), nil
+}
+
+// NewReplayer returns a Replayer of the messages at the original speed.
+func NewReplayer(messages []*RecordedMessage) *Replayer {
+	return &Replayer{Speed: 1, messages: messages}
+}
+
+// OpenReplayer reads the messages recorded to the file of the path.
+func OpenReplayer(path string) (*Replayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+	messages, err := ReadRecordedMessages(file)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(messages), nil
+}
+
+// replayServer 实现了 Bot 用到的 APIServer 接口
+type replayServer struct {
+	replayer  *Replayer
+	account   *Account
+	exhausted chan struct{}
+	finish    sync.Once
+
+	mu    sync.Mutex
+	next  int
+	start time.Time
+	sent  []*CapturedSend
+}
+
+func newReplayServer(replayer *Replayer) *replayServer {
+	account := replayer.Account
+	if account == nil {
+		account = &Account{Account: "replay"}
+		if len(replayer.messages) > 0 {
+			account.Wxid = replayer.messages[0].Message.ToUser
+		}
+	}
+	return &replayServer{replayer: replayer, account: account, exhausted: make(chan struct{})}
+}
+
+func (s *replayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case apiserver.CheckLogin:
+		writeReplayResult(w, apiserver.OK(true))
+	case apiserver.GetUserInfo:
+		writeReplayResult(w, apiserver.OK(s.account))
+	case apiserver.GetContactList:
+		contacts := s.replayer.Contacts
+		if contacts == nil {
+			contacts = Members{}
+		}
+		writeReplayResult(w, apiserver.OK(contacts))
+	case apiserver.SyncMessage:
+		messages, err := s.nextMessages(r.Context())
+		if err != nil {
+			writeReplayResult(w, apiserver.Err[any](err.Error()))
+			return
+		}
+		writeReplayResult(w, apiserver.OK(messages))
+	case apiserver.GetChatRoomDetail, apiserver.GetMemberFromChatRoom:
+		var req struct {
+			ChatRoomID string `json:"chatRoomId"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path == apiserver.GetChatRoomDetail {
+			writeReplayResult(w, apiserver.OK(map[string]string{"chatRoomId": req.ChatRoomID}))
+			return
+		}
+		members := s.replayer.GroupMembers[req.ChatRoomID]
+		if members == nil {
+			members = []*Profile{}
+		}
+		writeReplayResult(w, apiserver.OK(members))
+	case apiserver.UploadFile:
+		// 只需要文件名，发送时记录下来
+		writeReplayResult(w, apiserver.OK(r.FormValue("filename")))
+	case apiserver.SendText, apiserver.SendImage, apiserver.SendFile, apiserver.SendAtText, apiserver.ForwardMsg,
+		apiserver.SendQuote, apiserver.AddMemberToChatRoom, apiserver.InviteMemberToChatRoom, apiserver.QuitChatRoom,
+		apiserver.DelMemberFromChatRoom, apiserver.ModifyNickname:
+		var req struct {
+			To         string   `json:"to"`
+			Content    string   `json:"content"`
+			Image      string   `json:"image"`
+			File       string   `json:"file"`
+			GroupID    string   `json:"groupId"`
+			AtList     []string `json:"atList"`
+			WxID       string   `json:"wxid"`
+			ChatRoomID string   `json:"chatRoomId"`
+			MemberIDs  []string `json:"memberIds"`
+			Nickname   string   `json:"nickname"`
+			// 转发的 msgId 是字符串，引用的 msgId 是数字
+			MsgID json.RawMessage `json:"msgId"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeReplayResult(w, apiserver.Err[any](err.Error()))
+			return
+		}
+		sent := &CapturedSend{
+			Route:   r.URL.Path,
+			To:      firstNonEmpty(req.To, req.GroupID, req.ChatRoomID, req.WxID),
+			Content: firstNonEmpty(req.Content, req.Nickname),
+			WxIDs:   append(req.AtList, req.MemberIDs...),
+			File:    firstNonEmpty(req.Image, req.File),
+			MsgID:   strings.Trim(string(req.MsgID), `"`),
+			Time:    time.Now(),
+		}
+		s.mu.Lock()
+		s.sent = append(s.sent, sent)
+		s.mu.Unlock()
+		writeReplayResult(w, apiserver.OK[any](nil))
+	case apiserver.DownloadMedia:
+		// 回放时没有媒体文件，按照不支持处理
+		http.NotFound(w, r)
+	default:
+		// apiserver 新增的接口需要在这里处理
+		http.Error(w, "replay: unsupported route "+r.URL.Path, http.StatusNotImplemented)
+	}
+}
+
+// nextMessages waits until the time of the next message and returns it.
+// After all the messages are returned it blocks until the request is canceled.
+func (s *replayServer) nextMessages(ctx context.Context) ([]*Message, error) {
+	messages := s.replayer.messages
+	s.mu.Lock()
+	index := s.next
+	if index == 0 {
+		s.start = time.Now()
+	}
+	start := s.start
+	s.mu.Unlock()
+
+	if index >= len(messages) {
+		s.finish.Do(func() { close(s.exhausted) })
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	record := messages[index]
+	if speed := s.replayer.Speed; speed > 0 {
+		// 按照相对第一条消息的时间计算，避免误差累积
+		offset := time.Duration(float64(record.Time.Sub(messages[0].Time)) / speed)
+		timer := time.NewTimer(time.Until(start.Add(offset)))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	s.mu.Lock()
+	s.next++
+	s.mu.Unlock()
+	return []*Message{record.Message}, nil
+}
+
+func (s *replayServer) captured() []*CapturedSend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*CapturedSend(nil), s.sent...)
+}
+
+func writeReplayResult[T any](w http.ResponseWriter, result *apiserver.Result[T]) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
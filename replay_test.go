@@ -0,0 +1,112 @@
+package wxhelper
+
+import (
+	"bytes"
+	"context"
+	"github.com/eatmoreapple/wxhelper/apiserver"
+	"github.com/eatmoreapple/wxhelper/wxtest"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot"})
+	var buf bytes.Buffer
+	recorded := make(chan struct{}, 2)
+	bot := New(stack.URL)
+	bot.Recorder = NewMessageRecorder(&buf)
+	bot.MessageHandler = func(msg *Message) { recorded <- struct{}{} }
+	t.Cleanup(bot.Stop)
+	go func() { _ = bot.Run() }()
+
+	for _, content := range []string{"ping", "hello"} {
+		if err := stack.InjectText("wxid_a", content); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-recorded:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the message is not handled")
+		}
+	}
+	bot.Stop()
+
+	messages, err := ReadRecordedMessages(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].Message.Content != "ping" || messages[1].Message.FromUser != "wxid_a" {
+		t.Fatalf("unexpected recorded messages %v", messages)
+	}
+	// 两条消息间隔 1 秒，10 倍速回放需要 100 毫秒
+	messages[1].Time = messages[0].Time.Add(time.Second)
+
+	replayer := NewReplayer(messages)
+	replayer.Speed = 10
+	start := time.Now()
+	sent, err := replayer.Replay(func(bot *Bot) {
+		bot.MessageHandler = func(msg *Message) {
+			_ = msg.ReplyText("re: " + msg.Content)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("unexpected replay duration %s", elapsed)
+	}
+	if len(sent) != 2 {
+		t.Fatalf("expected 2 sends, got %d", len(sent))
+	}
+	for i, expected := range []string{"re: ping", "re: hello"} {
+		if sent[i].Route != apiserver.SendText || sent[i].To != "wxid_a" || sent[i].Content != expected {
+			t.Fatalf("unexpected send %+v", sent[i])
+		}
+	}
+	// 录制的消息没有真正发送
+	if len(stack.Sent()) != 0 {
+		t.Fatalf("unexpected sends %v", stack.Sent())
+	}
+}
+
+// TestReplayServerRoutes fails when a route added to apiserver/spec.go is not handled by the replay server.
+func TestReplayServerRoutes(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), filepath.Join("apiserver", "spec.go"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var routes []string
+	ast.Inspect(file, func(node ast.Node) bool {
+		if lit, ok := node.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			route, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			routes = append(routes, route)
+		}
+		return true
+	})
+	if len(routes) == 0 {
+		t.Fatal("no routes found in apiserver/spec.go")
+	}
+	srv := newReplayServer(NewReplayer(nil))
+	// 已经取消的请求不会阻塞在 SyncMessage
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, route := range routes {
+		req := httptest.NewRequest(http.MethodPost, route, strings.NewReader("{}")).WithContext(ctx)
+		recorder := httptest.NewRecorder()
+		srv.ServeHTTP(recorder, req)
+		if recorder.Code == http.StatusNotImplemented {
+			t.Fatalf("route %s is not handled by the replay server", route)
+		}
+	}
+}
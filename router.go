@@ -0,0 +1,200 @@
+package wxhelper
+
+import (
+	"github.com/rs/zerolog/log"
+	"runtime/debug"
+)
+
+// HandlerFunc 路由处理函数，中间件也是这个形式
+type HandlerFunc func(ctx *MessageContext)
+
+// MessageContext 一次消息分发的上下文，在中间件和处理函数之间传递
+type MessageContext struct {
+	*Message
+	handlers []HandlerFunc
+	index    int
+	stopped  bool
+}
+
+// Next executes the pending handlers in the chain inside the calling handler.
+// It should only be used inside middleware.
+func (c *MessageContext) Next() {
+	c.index++
+	for c.index < len(c.handlers) {
+		c.handlers[c.index](c)
+		c.index++
+	}
+}
+
+// Abort prevents pending handlers of the current route from being called.
+// Routes registered after the current one are still matched.
+func (c *MessageContext) Abort() {
+	c.index = len(c.handlers)
+}
+
+// IsAborted returns true if the current route was aborted.
+func (c *MessageContext) IsAborted() bool {
+	return c.index >= len(c.handlers)
+}
+
+// StopPropagation aborts the current route and prevents the message from
+// being dispatched to the routes registered after it.
+func (c *MessageContext) StopPropagation() {
+	c.Abort()
+	c.stopped = true
+}
+
+// IsStopped returns true if StopPropagation was called.
+func (c *MessageContext) IsStopped() bool {
+	return c.stopped
+}
+
+// run executes the handlers as a new chain and restores the outer chain afterward.
+func (c *MessageContext) run(handlers []HandlerFunc) {
+	prevHandlers, prevIndex := c.handlers, c.index
+	defer func() { c.handlers, c.index = prevHandlers, prevIndex }()
+	c.handlers, c.index = handlers, -1
+	c.Next()
+}
+
+type route struct {
+	matcher  Matcher
+	handlers []HandlerFunc
+}
+
+// RouterGroup 一组共享匹配条件和中间件的路由
+type RouterGroup struct {
+	router      *Router
+	matcher     Matcher
+	middlewares []HandlerFunc
+}
+
+// Use adds middlewares to the group.
+// Only routes registered after Use are affected.
+func (g *RouterGroup) Use(middlewares ...HandlerFunc) {
+	g.middlewares = append(g.middlewares, middlewares...)
+}
+
+// Group creates a sub group. A message must match both the parent group and
+// the given matcher to reach the routes of the sub group.
+func (g *RouterGroup) Group(matcher Matcher, middlewares ...HandlerFunc) *RouterGroup {
+	return &RouterGroup{
+		router:      g.router,
+		matcher:     g.combineMatcher(matcher),
+		middlewares: g.combineHandlers(middlewares),
+	}
+}
+
+// Handle registers handlers for messages matched by matcher.
+// Routes are matched in the order they are registered.
+func (g *RouterGroup) Handle(matcher Matcher, handlers ...HandlerFunc) {
+	g.router.routes = append(g.router.routes, &route{
+		matcher:  g.combineMatcher(matcher),
+		handlers: g.combineHandlers(handlers),
+	})
+}
+
+func (g *RouterGroup) combineMatcher(matcher Matcher) Matcher {
+	switch {
+	case matcher == nil && g.matcher == nil:
+		return MatchAll()
+	case matcher == nil:
+		return g.matcher
+	case g.matcher == nil:
+		return matcher
+	default:
+		return g.matcher.And(matcher)
+	}
+}
+
+func (g *RouterGroup) combineHandlers(handlers []HandlerFunc) []HandlerFunc {
+	merged := make([]HandlerFunc, 0, len(g.middlewares)+len(handlers))
+	merged = append(merged, g.middlewares...)
+	return append(merged, handlers...)
+}
+
+// Router 按照注册顺序将消息分发给匹配的路由
+//
+//	router := wxhelper.NewRouter()
+//	router.Use(wxhelper.Recovery())
+//	router.Handle(wxhelper.MatchText().And(wxhelper.MatchContent("ping")), func(ctx *wxhelper.MessageContext) {
+//		_ = ctx.ReplyText("pong")
+//	})
+//	bot.MessageHandler = router.ServeMessage
+type Router struct {
+	*RouterGroup
+	middlewares []HandlerFunc
+	routes      []*route
+}
+
+// Use adds global middlewares which run once for every message,
+// whether it matches a route or not.
+func (r *Router) Use(middlewares ...HandlerFunc) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// ServeMessage dispatches the message to the matched routes.
+// It is safe to be called concurrently once all routes are registered.
+func (r *Router) ServeMessage(msg *Message) {
+	ctx := &MessageContext{Message: msg, index: -1}
+	handlers := make([]HandlerFunc, 0, len(r.middlewares)+1)
+	handlers = append(handlers, r.middlewares...)
+	ctx.run(append(handlers, r.dispatch))
+}
+
+func (r *Router) dispatch(ctx *MessageContext) {
+	for _, route := range r.routes {
+		if ctx.IsStopped() {
+			return
+		}
+		if route.matcher(ctx.Message) {
+			ctx.run(route.handlers)
+		}
+	}
+}
+
+func NewRouter() *Router {
+	router := &Router{}
+	router.RouterGroup = &RouterGroup{router: router}
+	return router
+}
+
+// Recovery recovers from panics in the following handlers and logs them.
+func Recovery() HandlerFunc {
+	return func(ctx *MessageContext) {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Error().
+					Interface("panic", err).
+					Int64("msgId", ctx.MsgId).
+					Str("stack", string(debug.Stack())).
+					Msg("message handler panic")
+				ctx.StopPropagation()
+			}
+		}()
+		ctx.Next()
+	}
+}
+
+// Logger logs every message passing through it.
+func Logger() HandlerFunc {
+	return func(ctx *MessageContext) {
+		log.Info().
+			Int64("msgId", ctx.MsgId).
+			Int("type", ctx.Type).
+			Str("fromUser", ctx.FromUser).
+			Msg("receive message")
+		ctx.Next()
+	}
+}
+
+// Auth aborts the following handlers if allow returns false.
+func Auth(allow func(msg *Message) bool) HandlerFunc {
+	return func(ctx *MessageContext) {
+		if !allow(ctx.Message) {
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,80 @@
+package wxhelper
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestContentMatchers(t *testing.T) {
+	private := &Message{FromUser: "wxid_a", ToUser: "wxid_bot", Type: 1, Content: "ping 123"}
+	group := &Message{FromUser: "123@chatroom", ToUser: "wxid_bot", Type: 1, Content: "wxid_a:\nping 123"}
+	cases := []struct {
+		name    string
+		matcher Matcher
+		match   bool
+	}{
+		{"content", MatchContent("ping 123"), true},
+		{"content mismatch", MatchContent("ping"), false},
+		{"prefix", MatchPrefix("ping"), true},
+		{"prefix mismatch", MatchPrefix("pong"), false},
+		{"regexp", MatchRegexp(regexp.MustCompile(`^ping \d+$`)), true},
+		{"sender prefix is not content", MatchPrefix("wxid_a"), false},
+	}
+	for _, c := range cases {
+		// 群消息的内容以 "wxid:\n" 开头，匹配时需要去掉
+		for _, msg := range []*Message{private, group} {
+			if got := c.matcher(msg); got != c.match {
+				t.Fatalf("%s: expected %v for %s, got %v", c.name, c.match, msg.FromUser, got)
+			}
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	router := NewRouter()
+	var handled []string
+	router.Use(func(ctx *MessageContext) {
+		handled = append(handled, "global")
+		ctx.Next()
+	})
+	router.Handle(MatchGroup().And(MatchContent("ping")), func(ctx *MessageContext) {
+		handled = append(handled, "group ping")
+	})
+	router.Handle(MatchPrivate().And(MatchPrefix("ping")), func(ctx *MessageContext) {
+		handled = append(handled, "private ping")
+		ctx.StopPropagation()
+	})
+	admin := router.Group(MatchSender("wxid_admin"), func(ctx *MessageContext) {
+		handled = append(handled, "admin")
+		ctx.Next()
+	})
+	admin.Handle(MatchPrefix("/"), func(ctx *MessageContext) {
+		handled = append(handled, "command "+ctx.Text())
+	})
+	router.Handle(nil, func(ctx *MessageContext) {
+		handled = append(handled, "fallback")
+	})
+
+	cases := []struct {
+		msg      *Message
+		expected []string
+	}{
+		{&Message{FromUser: "123@chatroom", Type: 1, Content: "wxid_a:\nping"}, []string{"global", "group ping", "fallback"}},
+		// StopPropagation 之后不再匹配后面的路由
+		{&Message{FromUser: "wxid_a", Type: 1, Content: "ping"}, []string{"global", "private ping"}},
+		{&Message{FromUser: "123@chatroom", Type: 1, Content: "wxid_admin:\n/reload"}, []string{"global", "admin", "command /reload", "fallback"}},
+		{&Message{FromUser: "123@chatroom", Type: 1, Content: "wxid_a:\n/reload"}, []string{"global", "fallback"}},
+	}
+	for _, c := range cases {
+		handled = nil
+		router.ServeMessage(c.msg)
+		if len(handled) != len(c.expected) {
+			t.Fatalf("expected %v, got %v", c.expected, handled)
+		}
+		for i := range c.expected {
+			if handled[i] != c.expected[i] {
+				t.Fatalf("expected %v, got %v", c.expected, handled)
+			}
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package wxhelper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrJobNotFound is returned when the scheduled job does not exist.
+var ErrJobNotFound = errors.New("scheduled job not found")
+
+// ErrEmptyContent is the error of a run whose ContentFunc returns no Text, Image or File.
+var ErrEmptyContent = errors.New("scheduled content is empty")
+
+// ScheduledContent 是定时任务在运行时生成的消息内容，Text、Image 和 File 中至少有一个
+type ScheduledContent struct {
+	Text string
+	// Image is closed after sending if it is an io.Closer.
+	Image io.Reader
+	// File is closed after sending if it is an io.Closer.
+	File io.Reader
+}
+
+// ContentFunc 在定时任务运行时生成消息内容
+type ContentFunc func(ctx context.Context, job *ScheduledJob) (*ScheduledContent, error)
+
+// ScheduledJob 是一个定时发送消息的任务，Cron 和 At 必须且只能设置一个
+type ScheduledJob struct {
+	ID string `json:"id"`
+	// Cron is the cron expression of a recurring job, see ParseCron.
+	Cron string `json:"cron,omitempty"`
+	// At is the time of a one-shot job.
+	At time.Time `json:"at,omitempty"`
+	// To is the wxid of the user or group to send to.
+	To string `json:"to"`
+	// Text is sent if Content is empty.
+	Text string `json:"text,omitempty"`
+	// Content is the name of the ContentFunc registered by Scheduler.RegisterContent.
+	Content string `json:"content,omitempty"`
+
+	// NextRunAt is zero if the one-shot job failed after all the retries.
+	NextRunAt time.Time `json:"nextRunAt"`
+	LastRunAt time.Time `json:"lastRunAt,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+	// Retries is the number of failed runs of the one-shot job.
+	Retries int `json:"retries,omitempty"`
+
+	schedule *CronSchedule
+}
+
+// next returns the next run time after t, the zero time if the job will not run again.
+func (j *ScheduledJob) next(t time.Time) time.Time {
+	if j.schedule != nil {
+		return j.schedule.Next(t)
+	}
+	return time.Time{}
+}
+
+// Scheduler 定时给好友或者群发送消息，任务保存在 JSON 文件中，重启之后继续执行。
+// 错过的周期任务不会补发，错过的一次性任务在启动后立即执行。
+// 发送失败的一次性任务会重试，重试都失败之后保留在 Jobs 中并记录 LastError，不再运行，需要 Cancel 删除。
+type Scheduler struct {
+	// RetryInterval 是一次性任务失败后重试的间隔，默认 1 分钟
+	RetryInterval time.Duration
+	// MaxRetries 是一次性任务失败后重试的次数，默认 5 次，小于 0 时不重试
+	MaxRetries int
+
+	bot      *Bot
+	path     string
+	mu       sync.Mutex
+	jobs     map[string]*ScheduledJob
+	contents map[string]ContentFunc
+	wake     chan struct{}
+}
+
+// RegisterContent registers the ContentFunc with the name, so that the jobs can refer to it.
+func (s *Scheduler) RegisterContent(name string, fn ContentFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contents[name] = fn
+}
+
+// Add validates and adds the job, the id is generated.
+// The ContentFunc of the job must be registered before.
+func (s *Scheduler) Add(job ScheduledJob) (*ScheduledJob, error) {
+	if job.To == "" {
+		return nil, errors.New("scheduler: no target to send to")
+	}
+	if job.Text == "" && job.Content == "" {
+		return nil, errors.New("scheduler: no text or content")
+	}
+	job.ID = uuid.New().String()
+	job.LastRunAt, job.LastError, job.Retries = time.Time{}, "", 0
+	if err := job.prepare(time.Now()); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.contents[job.Content]; job.Content != "" && !ok {
+		return nil, fmt.Errorf("scheduler: content %q is not registered", job.Content)
+	}
+	s.jobs[job.ID] = &job
+	if err := s.save(); err != nil {
+		delete(s.jobs, job.ID)
+		return nil, err
+	}
+	s.notify()
+	clone := job
+	return &clone, nil
+}
+
+// prepare parses the cron expression and computes the next run time.
+func (j *ScheduledJob) prepare(now time.Time) error {
+	switch {
+	case j.Cron != "" && !j.At.IsZero():
+		return errors.New("scheduler: both cron and at are set")
+	case j.Cron != "":
+		schedule, err := ParseCron(j.Cron)
+		if err != nil {
+			return err
+		}
+		j.schedule = schedule
+		if j.NextRunAt = schedule.Next(now); j.NextRunAt.IsZero() {
+			return fmt.Errorf("scheduler: %q never runs", j.Cron)
+		}
+	case !j.At.IsZero():
+		j.NextRunAt = j.At
+	default:
+		return errors.New("scheduler: neither cron nor at is set")
+	}
+	return nil
+}
+
+// Cron adds a recurring job that sends the content generated by the ContentFunc registered as contentFunc.
+func (s *Scheduler) Cron(expr string, to Recipient, contentFunc string) (*ScheduledJob, error) {
+	return s.Add(ScheduledJob{Cron: expr, To: to.recipientID(), Content: contentFunc})
+}
+
+// CronText adds a recurring job that sends the text.
+func (s *Scheduler) CronText(expr string, to Recipient, text string) (*ScheduledJob, error) {
+	return s.Add(ScheduledJob{Cron: expr, To: to.recipientID(), Text: text})
+}
+
+// Once adds a one-shot job that sends the content generated by the ContentFunc registered as contentFunc at the time.
+func (s *Scheduler) Once(at time.Time, to Recipient, contentFunc string) (*ScheduledJob, error) {
+	return s.Add(ScheduledJob{At: at, To: to.recipientID(), Content: contentFunc})
+}
+
+// OnceText adds a one-shot job that sends the text at the time.
+func (s *Scheduler) OnceText(at time.Time, to Recipient, text string) (*ScheduledJob, error) {
+	return s.Add(ScheduledJob{At: at, To: to.recipientID(), Text: text})
+}
+
+// Cancel removes the job.
+func (s *Scheduler) Cancel(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+	delete(s.jobs, id)
+	if err := s.save(); err != nil {
+		s.jobs[id] = job
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// Jobs returns the jobs ordered by the next run time.
+func (s *Scheduler) Jobs() []*ScheduledJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]*ScheduledJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		clone := *job
+		jobs = append(jobs, &clone)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].NextRunAt.Before(jobs[j].NextRunAt) })
+	return jobs
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run runs the due jobs until the context or the bot's context is done.
+func (s *Scheduler) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	// 跟随 Bot 的生命周期
+	stop := context.AfterFunc(s.bot.Context(), func() { cancel(context.Cause(s.bot.Context())) })
+	defer stop()
+	for {
+		timer := time.NewTimer(s.untilNext())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return context.Cause(ctx)
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+			s.runDue(ctx)
+		}
+	}
+}
+
+// untilNext returns the duration until the next job, an hour if there is no job.
+func (s *Scheduler) untilNext() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wait := time.Hour
+	for _, job := range s.jobs {
+		if job.NextRunAt.IsZero() {
+			continue
+		}
+		if until := time.Until(job.NextRunAt); until < wait {
+			wait = until
+		}
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+func (s *Scheduler) runDue(ctx context.Context) {
+	now := time.Now()
+	s.mu.Lock()
+	var due []*ScheduledJob
+	for _, job := range s.jobs {
+		if !job.NextRunAt.IsZero() && !job.NextRunAt.After(now) {
+			clone := *job
+			due = append(due, &clone)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(due, func(i, j int) bool { return due[i].NextRunAt.Before(due[j].NextRunAt) })
+
+	for _, job := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		err := s.runJob(ctx, job)
+		if err != nil {
+			log.Error().Err(err).Str("job", job.ID).Msg("run scheduled job")
+		}
+		s.finish(job.ID, now, err)
+	}
+}
+
+func (s *Scheduler) runJob(ctx context.Context, job *ScheduledJob) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("scheduler: panic: %v", recovered)
+		}
+	}()
+	content := &ScheduledContent{Text: job.Text}
+	if job.Content != "" {
+		s.mu.Lock()
+		fn, ok := s.contents[job.Content]
+		s.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("scheduler: content %q is not registered", job.Content)
+		}
+		if content, err = fn(ctx, job); err != nil {
+			return err
+		}
+	}
+	if content == nil || (content.Text == "" && content.Image == nil && content.File == nil) {
+		return ErrEmptyContent
+	}
+	account, err := s.bot.GetLoginAccount()
+	if err != nil {
+		return err
+	}
+	for _, reader := range []io.Reader{content.Image, content.File} {
+		if closer, ok := reader.(io.Closer); ok {
+			defer func() { _ = closer.Close() }()
+		}
+	}
+	if content.Text != "" {
+		if err = account.sendText(job.To, content.Text); err != nil {
+			return err
+		}
+	}
+	if content.Image != nil {
+		if err = account.sendImage(job.To, content.Image); err != nil {
+			return err
+		}
+	}
+	if content.File != nil {
+		if err = account.sendFile(job.To, content.File); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish records the result of the job and schedules its next run.
+func (s *Scheduler) finish(id string, now time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 运行期间可能被取消
+	job, ok := s.jobs[id]
+	if !ok {
+		return
+	}
+	job.LastRunAt, job.LastError = now, ""
+	if err != nil {
+		job.LastError = err.Error()
+	}
+	switch {
+	case job.schedule != nil:
+		job.NextRunAt = job.next(now)
+	case err == nil:
+		delete(s.jobs, id)
+	case job.Retries < s.maxRetries():
+		job.Retries++
+		job.NextRunAt = now.Add(s.retryInterval())
+	default:
+		// 保留失败的任务，Jobs 中可以看到错误
+		job.NextRunAt = time.Time{}
+	}
+	if err = s.save(); err != nil {
+		log.Error().Err(err).Str("path", s.path).Msg("save scheduled jobs")
+	}
+}
+
+func (s *Scheduler) retryInterval() time.Duration {
+	if s.RetryInterval > 0 {
+		return s.RetryInterval
+	}
+	return time.Minute
+}
+
+func (s *Scheduler) maxRetries() int {
+	switch {
+	case s.MaxRetries < 0:
+		return 0
+	case s.MaxRetries == 0:
+		return 5
+	}
+	return s.MaxRetries
+}
+
+// save writes the jobs to the file, the caller must hold the lock.
+func (s *Scheduler) save() error {
+	if s.path == "" {
+		return nil
+	}
+	jobs := make([]*ScheduledJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *Scheduler) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var jobs []*ScheduledJob
+	if err = json.Unmarshal(data, &jobs); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, job := range jobs {
+		if job.Cron != "" {
+			if job.schedule, err = ParseCron(job.Cron); err != nil {
+				return err
+			}
+			// 错过的周期任务不补发
+			if job.NextRunAt.Before(now) {
+				job.NextRunAt = job.schedule.Next(now)
+			}
+		}
+		s.jobs[job.ID] = job
+	}
+	return nil
+}
+
+// NewScheduler returns a Scheduler that sends messages with the login account of the bot.
+// The jobs are persisted to the JSON file at path, or kept in memory if path is empty.
+func NewScheduler(bot *Bot, path string) (*Scheduler, error) {
+	scheduler := &Scheduler{
+		bot:      bot,
+		path:     path,
+		jobs:     make(map[string]*ScheduledJob),
+		contents: make(map[string]ContentFunc),
+		wake:     make(chan struct{}, 1),
+	}
+	if path != "" {
+		if err := scheduler.load(); err != nil {
+			return nil, err
+		}
+	}
+	return scheduler, nil
+}
@@ -0,0 +1,157 @@
+package wxhelper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	sent := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"data":{"account":"bot","wxid":"wxid_bot"}}`))
+	})
+	mux.HandleFunc("/api/send-text", func(w http.ResponseWriter, r *http.Request) {
+		sent <- r.URL.Path
+		_, _ = w.Write([]byte(`{"code":0}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	bot := New(server.URL)
+	scheduler, err := NewScheduler(bot, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有注册的 ContentFunc 不能添加
+	if _, err = scheduler.Cron("0 9 * * *", WxID("123@chatroom"), "report"); err == nil {
+		t.Fatal("expected error for an unregistered content")
+	}
+	scheduler.RegisterContent("report", func(ctx context.Context, job *ScheduledJob) (*ScheduledContent, error) {
+		return &ScheduledContent{Text: "report"}, nil
+	})
+	group := &Group{User: &User{Wxid: "123@chatroom"}}
+	daily, err := scheduler.Cron("0 9 * * *", group, "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if daily.To != "123@chatroom" || daily.Content != "report" {
+		t.Fatalf("unexpected job %+v", daily)
+	}
+	once, err := scheduler.OnceText(time.Now().Add(10*time.Millisecond), &Friend{User: &User{Wxid: "wxid_a"}}, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if once.To != "wxid_a" || once.Text != "hello" {
+		t.Fatalf("unexpected job %+v", once)
+	}
+
+	// 重新加载后任务依然存在
+	scheduler, err = NewScheduler(bot, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs := scheduler.Jobs(); len(jobs) != 2 || jobs[1].ID != daily.ID {
+		t.Fatalf("unexpected jobs %v", jobs)
+	}
+	if err = scheduler.Cancel(daily.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = scheduler.Cancel(daily.ID); err != ErrJobNotFound {
+		t.Fatalf("expected %v, got %v", ErrJobNotFound, err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- scheduler.Run(context.Background()) }()
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("the one-shot job did not run")
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(scheduler.Jobs()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the one-shot job is not removed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 停止 Bot 后调度器也停止
+	bot.Stop()
+	select {
+	case err = <-done:
+		if err != ErrBotStopped {
+			t.Fatalf("expected %v, got %v", ErrBotStopped, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the scheduler did not stop")
+	}
+}
+
+func TestSchedulerFailures(t *testing.T) {
+	var attempts atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"data":{"account":"bot","wxid":"wxid_bot"}}`))
+	})
+	// Bot 离线时发送失败
+	mux.HandleFunc("/api/send-text", func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		_, _ = w.Write([]byte(`{"code":1,"msg":"offline"}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	bot := New(server.URL)
+	t.Cleanup(bot.Stop)
+	scheduler, err := NewScheduler(bot, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler.RetryInterval = 10 * time.Millisecond
+	scheduler.MaxRetries = 1
+	// ContentFunc 返回 nil 时不会 panic
+	scheduler.RegisterContent("nil", func(ctx context.Context, job *ScheduledJob) (*ScheduledContent, error) {
+		return nil, nil
+	})
+	empty, err := scheduler.Once(time.Now(), WxID("wxid_a"), "nil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	once, err := scheduler.OnceText(time.Now(), WxID("wxid_a"), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = scheduler.Run(context.Background()) }()
+
+	// 重试一次之后保留失败的任务
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		jobs := make(map[string]*ScheduledJob)
+		for _, job := range scheduler.Jobs() {
+			jobs[job.ID] = job
+		}
+		failed, ok := jobs[once.ID]
+		if !ok {
+			t.Fatal("the failed one-shot job is removed")
+		}
+		if failed.NextRunAt.IsZero() {
+			if failed.Retries != 1 || failed.LastError != "offline" || attempts.Load() != 2 {
+				t.Fatalf("unexpected job %+v after %d attempts", failed, attempts.Load())
+			}
+			if job := jobs[empty.ID]; job == nil || job.LastError != ErrEmptyContent.Error() {
+				t.Fatalf("expected %v, got %+v", ErrEmptyContent, job)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the job is not retried: %+v", failed)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
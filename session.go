@@ -0,0 +1,162 @@
+package wxhelper
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrSessionExists is returned when a session for the same chat and sender is already open.
+	ErrSessionExists = errors.New("session already exists")
+
+	// ErrSessionClosed is returned when waiting on a closed session.
+	ErrSessionClosed = errors.New("session closed")
+)
+
+// sessionBufferSize 会话中未被读取的消息的最大数量，超出的消息交给 MessageHandler 处理
+const sessionBufferSize = 8
+
+// Session 多轮对话，会话打开期间同一个聊天中同一个发送者的消息都会被会话截获，
+// 而不会再交给 Bot.MessageHandler 处理
+//
+//	answer, err := msg.Ask(ctx, "请输入订单号")
+type Session struct {
+	key     string
+	bot     *Bot
+	reply   *Message
+	msgCH   chan *Message
+	done    chan struct{}
+	closing sync.Once
+}
+
+// Next blocks until the next message of the session arrives.
+func (s *Session) Next(ctx context.Context) (*Message, error) {
+	// drain the buffered messages first
+	select {
+	case msg := <-s.msgCH:
+		return msg, nil
+	default:
+	}
+	select {
+	case msg := <-s.msgCH:
+		return msg, nil
+	case <-s.done:
+		return nil, ErrSessionClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.bot.Context().Done():
+		return nil, s.bot.Context().Err()
+	}
+}
+
+// Ask replies the question into the chat and waits for the answer.
+func (s *Session) Ask(ctx context.Context, question string) (*Message, error) {
+	if err := s.reply.ReplyText(question); err != nil {
+		return nil, err
+	}
+	return s.Next(ctx)
+}
+
+// Close closes the session, the following messages go to Bot.MessageHandler again.
+func (s *Session) Close() {
+	s.closing.Do(func() {
+		s.bot.sessions.remove(s)
+		close(s.done)
+	})
+}
+
+// deliver pushes the message into the session without blocking.
+func (s *Session) deliver(msg *Message) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+	select {
+	case s.msgCH <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+type sessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func (m *sessionManager) open(bot *Bot, msg *Message) (*Session, error) {
+	key := sessionKey(msg)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.sessions[key]; exists {
+		return nil, ErrSessionExists
+	}
+	if m.sessions == nil {
+		m.sessions = make(map[string]*Session)
+	}
+	session := &Session{
+		key:   key,
+		bot:   bot,
+		reply: msg,
+		msgCH: make(chan *Message, sessionBufferSize),
+		done:  make(chan struct{}),
+	}
+	m.sessions[key] = session
+	return session, nil
+}
+
+func (m *sessionManager) remove(session *Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions[session.key] == session {
+		delete(m.sessions, session.key)
+	}
+}
+
+// deliver reports whether the message is taken by a session.
+func (m *sessionManager) deliver(msg *Message) bool {
+	m.mu.Lock()
+	session, exists := m.sessions[sessionKey(msg)]
+	m.mu.Unlock()
+	return exists && session.deliver(msg)
+}
+
+// closeAll closes all the open sessions.
+func (m *sessionManager) closeAll() {
+	m.mu.Lock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	m.mu.Unlock()
+	for _, session := range sessions {
+		session.Close()
+	}
+}
+
+// sessionKey 会话的唯一标识，由聊天和发送者组成
+func sessionKey(msg *Message) string {
+	if msg.IsGroupMessage() {
+		return msg.FromUser + "/" + msg.SenderID()
+	}
+	return msg.FromUser
+}
+
+// Session opens a session for the chat and the sender of the message.
+// The session must be closed after use.
+func (m Message) Session() (*Session, error) {
+	bot := m.Owner().bot
+	return bot.sessions.open(bot, &m)
+}
+
+// Ask replies the question and waits for the next message from the same sender in the same chat.
+func (m Message) Ask(ctx context.Context, question string) (*Message, error) {
+	session, err := m.Session()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	return session.Ask(ctx, question)
+}
@@ -0,0 +1,71 @@
+package wxhelper
+
+import (
+	"context"
+	"errors"
+	"github.com/eatmoreapple/wxhelper/wxtest"
+	"testing"
+	"time"
+)
+
+func TestSession(t *testing.T) {
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot"})
+	bot := New(stack.URL)
+	bot.MessageHandler = func(msg *Message) {
+		switch msg.Text() {
+		case "order":
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			answer, err := msg.Ask(ctx, "请输入订单号")
+			if err != nil {
+				_ = msg.ReplyText(err.Error())
+				return
+			}
+			_ = msg.ReplyText("订单 " + answer.Text())
+		case "slow":
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if _, err := msg.Ask(ctx, "请输入订单号"); errors.Is(err, context.DeadlineExceeded) {
+				_ = msg.ReplyText("timeout")
+			}
+		default:
+			_ = msg.ReplyText("echo " + msg.Text())
+		}
+	}
+	t.Cleanup(bot.Stop)
+	go func() { _ = bot.Run() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	expectSent := func(n int, content string) {
+		t.Helper()
+		sent, err := stack.WaitSent(ctx, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last := sent[n-1]; last.Content != content {
+			t.Fatalf("expected %s, got %s", content, last.Content)
+		}
+	}
+
+	// 会话打开期间下一条消息交给会话，而不是 MessageHandler
+	if err := stack.InjectText("wxid_a", "order"); err != nil {
+		t.Fatal(err)
+	}
+	expectSent(1, "请输入订单号")
+	if err := stack.InjectText("wxid_a", "42"); err != nil {
+		t.Fatal(err)
+	}
+	expectSent(2, "订单 42")
+
+	// 等待超时之后会话关闭
+	if err := stack.InjectText("wxid_a", "slow"); err != nil {
+		t.Fatal(err)
+	}
+	expectSent(3, "请输入订单号")
+	expectSent(4, "timeout")
+	if err := stack.InjectText("wxid_a", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	expectSent(5, "echo hello")
+}
@@ -0,0 +1,398 @@
+package wxhelper
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotSystemMessage is returned when parsing a message which is not a system message.
+	ErrNotSystemMessage = errors.New("not a system message")
+
+	// ErrUnknownSystemMessage is returned when the system message is not recognized.
+	ErrUnknownSystemMessage = errors.New("unknown system message")
+)
+
+// SystemEvent 由系统消息（type 10000 和 10002）解析出来的事件，具体类型为
+// *RevokeEvent、*MemberJoinEvent、*MemberLeaveEvent、*PatEvent、*GroupRenameEvent 或者 *OwnerChangeEvent
+type SystemEvent interface {
+	// Message returns the system message the event is parsed from.
+	Message() *Message
+}
+
+type systemEvent struct{ msg *Message }
+
+func (e systemEvent) Message() *Message { return e.msg }
+
+// EventMember 事件中涉及的成员。
+// 纯文本的系统消息中只有显示名称，Wxid 可能为空；Self 表示当前登录的账号
+type EventMember struct {
+	Wxid     string
+	Nickname string
+	Self     bool
+}
+
+// RevokeEvent 撤回消息
+type RevokeEvent struct {
+	systemEvent
+	// MsgId is the id of the revoked message, 0 if unknown.
+	MsgId    int64
+	Operator EventMember
+}
+
+// MemberJoinEvent 成员加入群聊
+type MemberJoinEvent struct {
+	systemEvent
+	Inviter EventMember
+	Members []EventMember
+	// ViaQRCode is true if the members joined by scanning the QR code shared by the inviter.
+	ViaQRCode bool
+}
+
+// MemberLeaveEvent 成员被移出群聊，主动退出群聊不会产生系统消息
+type MemberLeaveEvent struct {
+	systemEvent
+	Operator EventMember
+	Members  []EventMember
+}
+
+// PatEvent 拍一拍
+type PatEvent struct {
+	systemEvent
+	From EventMember
+	To   EventMember
+}
+
+// GroupRenameEvent 修改群名
+type GroupRenameEvent struct {
+	systemEvent
+	Operator EventMember
+	Name     string
+}
+
+// OwnerChangeEvent 群主变更
+type OwnerChangeEvent struct {
+	systemEvent
+	Owner EventMember
+}
+
+// systemEventRule 通过正则匹配纯文本的系统消息，同时覆盖中文和英文客户端
+type systemEventRule struct {
+	expr  *regexp.Regexp
+	build func(base systemEvent, match []string, resolve memberResolver) SystemEvent
+}
+
+// memberResolver 将显示名称解析成成员
+type memberResolver func(names string) []EventMember
+
+// selfMember 当前登录的账号
+var selfMember = EventMember{Self: true}
+
+func first(members []EventMember) EventMember {
+	if len(members) == 0 {
+		return EventMember{}
+	}
+	return members[0]
+}
+
+var systemEventRules = []systemEventRule{
+	// 邀请入群
+	{
+		expr: regexp.MustCompile(`^"(.+?)"邀请"(.+)"加入了群聊|^"(.+?)" invited "(.+)" to the group chat`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			inviter, members := pick(match, 1, 3), pick(match, 2, 4)
+			return &MemberJoinEvent{systemEvent: base, Inviter: first(resolve(inviter)), Members: resolve(members)}
+		},
+	},
+	{
+		expr: regexp.MustCompile(`^你邀请"(.+)"加入了群聊|^You invited "(.+)" to the group chat`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			return &MemberJoinEvent{systemEvent: base, Inviter: selfMember, Members: resolve(pick(match, 1, 2))}
+		},
+	},
+	{
+		expr: regexp.MustCompile(`^"(.+?)"邀请你和"(.+)"加入了群聊|^"(.+?)" invited you and "(.+)" to the group chat`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			members := append([]EventMember{selfMember}, resolve(pick(match, 2, 4))...)
+			return &MemberJoinEvent{systemEvent: base, Inviter: first(resolve(pick(match, 1, 3))), Members: members}
+		},
+	},
+	{
+		expr: regexp.MustCompile(`^"(.+?)"邀请你加入了群聊|^"(.+?)" invited you to (?:the|a) group chat`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			return &MemberJoinEvent{systemEvent: base, Inviter: first(resolve(pick(match, 1, 2))), Members: []EventMember{selfMember}}
+		},
+	},
+	// 扫码入群
+	{
+		expr: regexp.MustCompile(`^"(.+?)"通过扫描"(.+?)"分享的二维码加入群聊|^"(.+?)" joined the group chat via the QR [Cc]ode shared by "(.+?)"`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			return &MemberJoinEvent{systemEvent: base, Inviter: first(resolve(pick(match, 2, 4))), Members: resolve(pick(match, 1, 3)), ViaQRCode: true}
+		},
+	},
+	{
+		expr: regexp.MustCompile(`^"(.+?)"通过扫描你分享的二维码加入群聊|^"(.+?)" joined the group chat via (?:the|your) QR [Cc]ode shared by you`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			return &MemberJoinEvent{systemEvent: base, Inviter: selfMember, Members: resolve(pick(match, 1, 2)), ViaQRCode: true}
+		},
+	},
+	// 移出群聊
+	{
+		expr: regexp.MustCompile(`^你将"(.+)"移出了群聊|^You removed "(.+)" from the group chat`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			return &MemberLeaveEvent{systemEvent: base, Operator: selfMember, Members: resolve(pick(match, 1, 2))}
+		},
+	},
+	{
+		expr: regexp.MustCompile(`^你被"(.+?)"移出群聊|^You were removed from the group chat by "(.+?)"`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			return &MemberLeaveEvent{systemEvent: base, Operator: first(resolve(pick(match, 1, 2))), Members: []EventMember{selfMember}}
+		},
+	},
+	// 修改群名
+	{
+		expr: regexp.MustCompile(`^"(.+?)"修改群名为“(.*)”|^"(.+?)" changed the group name to "(.*)"`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			return &GroupRenameEvent{systemEvent: base, Operator: first(resolve(pick(match, 1, 3))), Name: pick(match, 2, 4)}
+		},
+	},
+	{
+		expr: regexp.MustCompile(`^你修改群名为“(.*)”|^You changed the group name to "(.*)"`),
+		build: func(base systemEvent, match []string, _ memberResolver) SystemEvent {
+			return &GroupRenameEvent{systemEvent: base, Operator: selfMember, Name: pick(match, 1, 2)}
+		},
+	},
+	// 群主变更
+	{
+		expr: regexp.MustCompile(`^"(.+?)"已成为新群主|^"(.+?)" is now the (?:group )?owner`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			return &OwnerChangeEvent{systemEvent: base, Owner: first(resolve(pick(match, 1, 2)))}
+		},
+	},
+	{
+		expr: regexp.MustCompile(`^你已成为新群主|^You are now the (?:group )?owner`),
+		build: func(base systemEvent, _ []string, _ memberResolver) SystemEvent {
+			return &OwnerChangeEvent{systemEvent: base, Owner: selfMember}
+		},
+	},
+	// 撤回消息
+	{
+		expr: regexp.MustCompile(`^"(.+?)" ?撤回了一条消息|^"(.+?)" (?:recalled|has recalled) a message`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			return &RevokeEvent{systemEvent: base, Operator: first(resolve(pick(match, 1, 2)))}
+		},
+	},
+	{
+		expr: regexp.MustCompile(`^你撤回了一条消息|^You recalled a message`),
+		build: func(base systemEvent, _ []string, _ memberResolver) SystemEvent {
+			return &RevokeEvent{systemEvent: base, Operator: selfMember}
+		},
+	},
+	// 拍一拍
+	{
+		expr: regexp.MustCompile(`^"(.+?)" ?拍了拍 ?"(.+?)"|^"(.+?)" patted "(.+?)"`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			return &PatEvent{systemEvent: base, From: first(resolve(pick(match, 1, 3))), To: first(resolve(pick(match, 2, 4)))}
+		},
+	},
+	{
+		expr: regexp.MustCompile(`^"(.+?)" ?拍了拍我|^"(.+?)" patted me`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			return &PatEvent{systemEvent: base, From: first(resolve(pick(match, 1, 2))), To: selfMember}
+		},
+	},
+	{
+		expr: regexp.MustCompile(`^我拍了拍 ?"(.+?)"|^I patted "(.+?)"`),
+		build: func(base systemEvent, match []string, resolve memberResolver) SystemEvent {
+			return &PatEvent{systemEvent: base, From: selfMember, To: first(resolve(pick(match, 1, 2)))}
+		},
+	},
+}
+
+// pick returns the first non-empty submatch of the given groups,
+// the alternatives of a rule are captured by different groups.
+func pick(match []string, groups ...int) string {
+	for _, group := range groups {
+		if group < len(match) && match[group] != "" {
+			return match[group]
+		}
+	}
+	return ""
+}
+
+var namesSeparator = regexp.MustCompile(`、|", "|, `)
+
+// splitNames splits the names joined by the Chinese or English separator.
+func splitNames(names string) []string {
+	var result []string
+	for _, name := range namesSeparator.Split(names, -1) {
+		if name = strings.Trim(name, `" `); name != "" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// newMemberResolver returns a resolver which fills the wxid of the known nicknames.
+func newMemberResolver(known map[string]string) memberResolver {
+	return func(names string) []EventMember {
+		var members []EventMember
+		for _, name := range splitNames(names) {
+			members = append(members, EventMember{Wxid: known[name], Nickname: name})
+		}
+		return members
+	}
+}
+
+func parseSystemText(base systemEvent, text string, known map[string]string) (SystemEvent, error) {
+	text = strings.TrimSpace(text)
+	resolve := newMemberResolver(known)
+	for _, rule := range systemEventRules {
+		if match := rule.expr.FindStringSubmatch(text); match != nil {
+			return rule.build(base, match, resolve), nil
+		}
+	}
+	return nil, ErrUnknownSystemMessage
+}
+
+type sysMsgXML struct {
+	Type      string `xml:"type,attr"`
+	RevokeMsg struct {
+		Session    string `xml:"session"`
+		MsgID      string `xml:"msgid"`
+		NewMsgID   string `xml:"newmsgid"`
+		ReplaceMsg string `xml:"replacemsg"`
+	} `xml:"revokemsg"`
+	Pat struct {
+		FromUsername   string `xml:"fromusername"`
+		ChatUsername   string `xml:"chatusername"`
+		PattedUsername string `xml:"pattedusername"`
+		Template       string `xml:"template"`
+	} `xml:"pat"`
+	SysMsgTemplate struct {
+		ContentTemplate struct {
+			Template string `xml:"template"`
+			Links    []struct {
+				Name    string `xml:"name,attr"`
+				Members []struct {
+					Username string `xml:"username"`
+					Nickname string `xml:"nickname"`
+				} `xml:"memberlist>member"`
+				Separator string `xml:"separator"`
+			} `xml:"link_list>link"`
+		} `xml:"content_template"`
+	} `xml:"sysmsgtemplate"`
+}
+
+// ParseSystemEvent parses the event of a system message.
+// It returns ErrUnknownSystemMessage if the message is not recognized.
+func ParseSystemEvent(msg *Message) (SystemEvent, error) {
+	if !msg.IsSystemMessage() {
+		return nil, ErrNotSystemMessage
+	}
+	base := systemEvent{msg: msg}
+	if msg.Type == 10000 {
+		return parseSystemText(base, msg.Content, nil)
+	}
+	index := strings.Index(msg.Content, "<")
+	if index < 0 {
+		return nil, ErrUnknownSystemMessage
+	}
+	var sysMsg sysMsgXML
+	if err := unmarshalXML(msg.Content[index:], &sysMsg); err != nil {
+		return nil, err
+	}
+	switch sysMsg.Type {
+	case "revokemsg":
+		revoke := sysMsg.RevokeMsg
+		msgID, err := strconv.ParseInt(revoke.NewMsgID, 10, 64)
+		if err != nil {
+			msgID, _ = strconv.ParseInt(revoke.MsgID, 10, 64)
+		}
+		event := &RevokeEvent{systemEvent: base, MsgId: msgID}
+		if parsed, err := parseSystemText(base, revoke.ReplaceMsg, nil); err == nil {
+			if text, ok := parsed.(*RevokeEvent); ok {
+				event.Operator = text.Operator
+			}
+		}
+		return event, nil
+	case "pat":
+		pat := sysMsg.Pat
+		return &PatEvent{
+			systemEvent: base,
+			From:        EventMember{Wxid: pat.FromUsername},
+			To:          EventMember{Wxid: pat.PattedUsername},
+		}, nil
+	case "sysmsgtemplate":
+		// 模板形如 "$username$"邀请"$names$"加入了群聊，先用成员名称替换占位符，再按纯文本解析
+		tmpl := sysMsg.SysMsgTemplate.ContentTemplate
+		text := tmpl.Template
+		known := make(map[string]string)
+		for _, link := range tmpl.Links {
+			separator := link.Separator
+			if separator == "" {
+				separator = "、"
+			}
+			names := make([]string, 0, len(link.Members))
+			for _, member := range link.Members {
+				names = append(names, member.Nickname)
+				known[member.Nickname] = member.Username
+			}
+			text = strings.ReplaceAll(text, "$"+link.Name+"$", strings.Join(names, separator))
+		}
+		return parseSystemText(base, text, known)
+	default:
+		return nil, ErrUnknownSystemMessage
+	}
+}
+
+// SystemEvent parses the event of a system message.
+func (m Message) SystemEvent() (SystemEvent, error) {
+	return ParseSystemEvent(&m)
+}
+
+// SystemEventHandlers 系统消息事件的处理函数，未设置的事件会被忽略
+type SystemEventHandlers struct {
+	OnRevoke      func(event *RevokeEvent)
+	OnMemberJoin  func(event *MemberJoinEvent)
+	OnMemberLeave func(event *MemberLeaveEvent)
+	OnPat         func(event *PatEvent)
+	OnGroupRename func(event *GroupRenameEvent)
+	OnOwnerChange func(event *OwnerChangeEvent)
+	// OnSystemEvent is called with every parsed event before the typed handlers.
+	OnSystemEvent func(event SystemEvent)
+}
+
+func (h *SystemEventHandlers) serveSystemEvent(event SystemEvent) {
+	if h.OnSystemEvent != nil {
+		h.OnSystemEvent(event)
+	}
+	switch event := event.(type) {
+	case *RevokeEvent:
+		if h.OnRevoke != nil {
+			h.OnRevoke(event)
+		}
+	case *MemberJoinEvent:
+		if h.OnMemberJoin != nil {
+			h.OnMemberJoin(event)
+		}
+	case *MemberLeaveEvent:
+		if h.OnMemberLeave != nil {
+			h.OnMemberLeave(event)
+		}
+	case *PatEvent:
+		if h.OnPat != nil {
+			h.OnPat(event)
+		}
+	case *GroupRenameEvent:
+		if h.OnGroupRename != nil {
+			h.OnGroupRename(event)
+		}
+	case *OwnerChangeEvent:
+		if h.OnOwnerChange != nil {
+			h.OnOwnerChange(event)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package wxhelper
+
+import "testing"
+
+func TestParseMemberJoinEvent(t *testing.T) {
+	for _, content := range []string{
+		`"张三"邀请"李四、王五"加入了群聊`,
+		`"张三" invited "李四, 王五" to the group chat`,
+	} {
+		event, err := ParseSystemEvent(&Message{Type: 10000, Content: content, FromUser: "123@chatroom"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		join, ok := event.(*MemberJoinEvent)
+		if !ok {
+			t.Fatalf("expected *MemberJoinEvent, got %T", event)
+		}
+		if join.Inviter.Nickname != "张三" {
+			t.Fatalf("expected 张三, got %s", join.Inviter.Nickname)
+		}
+		if len(join.Members) != 2 || join.Members[0].Nickname != "李四" || join.Members[1].Nickname != "王五" {
+			t.Fatalf("unexpected members %v", join.Members)
+		}
+		if join.Message().FromUser != "123@chatroom" {
+			t.Fatalf("expected 123@chatroom, got %s", join.Message().FromUser)
+		}
+	}
+}
+
+func TestParseQRCodeJoinEvent(t *testing.T) {
+	for _, content := range []string{
+		`"李四"通过扫描"张三"分享的二维码加入群聊`,
+		`"李四" joined the group chat via the QR Code shared by "张三"`,
+	} {
+		event, err := ParseSystemEvent(&Message{Type: 10000, Content: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+		join, ok := event.(*MemberJoinEvent)
+		if !ok {
+			t.Fatalf("expected *MemberJoinEvent, got %T", event)
+		}
+		if !join.ViaQRCode || join.Inviter.Nickname != "张三" || join.Members[0].Nickname != "李四" {
+			t.Fatalf("unexpected event %+v", join)
+		}
+	}
+}
+
+func TestParseSystemTextEvents(t *testing.T) {
+	cases := []struct {
+		content string
+		check   func(event SystemEvent) bool
+	}{
+		{`你将"李四"移出了群聊`, func(event SystemEvent) bool {
+			leave, ok := event.(*MemberLeaveEvent)
+			return ok && leave.Operator.Self && leave.Members[0].Nickname == "李四"
+		}},
+		{`You were removed from the group chat by "张三"`, func(event SystemEvent) bool {
+			leave, ok := event.(*MemberLeaveEvent)
+			return ok && leave.Operator.Nickname == "张三" && leave.Members[0].Self
+		}},
+		{`"张三"修改群名为“周末爬山群”`, func(event SystemEvent) bool {
+			rename, ok := event.(*GroupRenameEvent)
+			return ok && rename.Operator.Nickname == "张三" && rename.Name == "周末爬山群"
+		}},
+		{`You changed the group name to "Hiking"`, func(event SystemEvent) bool {
+			rename, ok := event.(*GroupRenameEvent)
+			return ok && rename.Operator.Self && rename.Name == "Hiking"
+		}},
+		{`"张三" 撤回了一条消息`, func(event SystemEvent) bool {
+			revoke, ok := event.(*RevokeEvent)
+			return ok && revoke.Operator.Nickname == "张三"
+		}},
+		{`"Alice" patted "Bob"`, func(event SystemEvent) bool {
+			pat, ok := event.(*PatEvent)
+			return ok && pat.From.Nickname == "Alice" && pat.To.Nickname == "Bob"
+		}},
+		{`"张三"已成为新群主`, func(event SystemEvent) bool {
+			owner, ok := event.(*OwnerChangeEvent)
+			return ok && owner.Owner.Nickname == "张三"
+		}},
+	}
+	for _, c := range cases {
+		event, err := ParseSystemEvent(&Message{Type: 10000, Content: c.content})
+		if err != nil {
+			t.Fatalf("%s: %v", c.content, err)
+		}
+		if !c.check(event) {
+			t.Fatalf("%s: unexpected event %+v", c.content, event)
+		}
+	}
+	if _, err := ParseSystemEvent(&Message{Type: 10000, Content: "以上是打招呼的内容"}); err != ErrUnknownSystemMessage {
+		t.Fatalf("expected %v, got %v", ErrUnknownSystemMessage, err)
+	}
+}
+
+func TestParseRevokeEvent(t *testing.T) {
+	content := `123@chatroom:
+<sysmsg type="revokemsg"><revokemsg><session>123@chatroom</session><msgid>1040356095</msgid><newmsgid>7123456789012345678</newmsgid><replacemsg><![CDATA["张三" 撤回了一条消息]]></replacemsg></revokemsg></sysmsg>`
+	event, err := ParseSystemEvent(&Message{Type: 10002, Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoke, ok := event.(*RevokeEvent)
+	if !ok {
+		t.Fatalf("expected *RevokeEvent, got %T", event)
+	}
+	if revoke.MsgId != 7123456789012345678 {
+		t.Fatalf("expected 7123456789012345678, got %d", revoke.MsgId)
+	}
+	if revoke.Operator.Nickname != "张三" {
+		t.Fatalf("expected 张三, got %s", revoke.Operator.Nickname)
+	}
+}
+
+func TestParsePatEvent(t *testing.T) {
+	content := `<sysmsg type="pat"><pat><fromusername>wxid_a</fromusername><chatusername>123@chatroom</chatusername><pattedusername>wxid_b</pattedusername><patsuffix><![CDATA[]]></patsuffix><template><![CDATA["${wxid_a}" 拍了拍 "${wxid_b}"]]></template></pat></sysmsg>`
+	event, err := ParseSystemEvent(&Message{Type: 10002, Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pat, ok := event.(*PatEvent)
+	if !ok {
+		t.Fatalf("expected *PatEvent, got %T", event)
+	}
+	if pat.From.Wxid != "wxid_a" || pat.To.Wxid != "wxid_b" {
+		t.Fatalf("unexpected pat %s -> %s", pat.From.Wxid, pat.To.Wxid)
+	}
+}
+
+func TestParseTemplateJoinEvent(t *testing.T) {
+	content := `<sysmsg type="sysmsgtemplate"><sysmsgtemplate><content_template type="tmpl_type_profile"><plain><![CDATA[]]></plain><template><![CDATA["$username$"邀请"$names$"加入了群聊]]></template><link_list><link name="username" type="link_profile"><memberlist><member><username><![CDATA[wxid_a]]></username><nickname><![CDATA[张三]]></nickname></member></memberlist></link><link name="names" type="link_profile"><memberlist><member><username><![CDATA[wxid_b]]></username><nickname><![CDATA[李四]]></nickname></member><member><username><![CDATA[wxid_c]]></username><nickname><![CDATA[王五]]></nickname></member></memberlist><separator><![CDATA[、]]></separator></link></link_list></content_template></sysmsgtemplate></sysmsg>`
+	event, err := ParseSystemEvent(&Message{Type: 10002, Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	join, ok := event.(*MemberJoinEvent)
+	if !ok {
+		t.Fatalf("expected *MemberJoinEvent, got %T", event)
+	}
+	if join.Inviter.Wxid != "wxid_a" {
+		t.Fatalf("expected wxid_a, got %s", join.Inviter.Wxid)
+	}
+	if len(join.Members) != 2 || join.Members[0].Wxid != "wxid_b" || join.Members[1].Wxid != "wxid_c" {
+		t.Fatalf("unexpected members %v", join.Members)
+	}
+}
@@ -9,6 +9,13 @@ import (
 
 var ErrNoSuchUserFound = errors.New("no such user found")
 
+var (
+	// ErrNotGroupAdmin is returned when the account is not the owner or an admin of the group.
+	ErrNotGroupAdmin = apiclient.ErrNotGroupAdmin
+	// ErrNotGroupMember is returned when the user is not a member of the group.
+	ErrNotGroupMember = apiclient.ErrNotGroupMember
+)
+
 type empty struct{}
 
 var (
@@ -63,6 +70,8 @@ type User struct {
 
 	// owner returns the owner of the user.
 	owner func() *Account
+	// index 是 ContactStore 中通讯录的索引，不是从通讯录中获取的用户为 nil
+	index *contactIndex
 }
 
 // IsGroup returns whether the user is a group.
@@ -132,8 +141,31 @@ func (f Friends) Search(limit uint, searchFunc func(friend *Friend) bool) Friend
 	return search
 }
 
+// indexed returns the index of the contact list if f is all the friends in it.
+func (f Friends) indexed() *contactIndex {
+	if len(f) == 0 {
+		return nil
+	}
+	index := f[0].index
+	if index == nil || index.friends != len(f) || f[len(f)-1].index != index {
+		return nil
+	}
+	return index
+}
+
+func (f Friends) searchIndex(index *contactIndex, users []*User, limit uint) Friends {
+	return index.search(users, f[0].owner, limit, (*User).IsFriend).Friends()
+}
+
 func (f Friends) SearchByWxID(wxID string) (*Friend, bool) {
-	search := f.Search(1, func(friend *Friend) bool { return friend.Wxid == wxID })
+	var search Friends
+	if index := f.indexed(); index != nil {
+		if user, ok := index.byWxID[wxID]; ok {
+			search = f.searchIndex(index, []*User{user}, 1)
+		}
+	} else {
+		search = f.Search(1, func(friend *Friend) bool { return friend.Wxid == wxID })
+	}
 	if len(search) == 0 {
 		return nil, false
 	}
@@ -141,10 +173,16 @@ func (f Friends) SearchByWxID(wxID string) (*Friend, bool) {
 }
 
 func (f Friends) SearchByNickname(nickname string, limit uint) Friends {
+	if index := f.indexed(); index != nil {
+		return f.searchIndex(index, index.byNickname[nickname], limit)
+	}
 	return f.Search(limit, func(friend *Friend) bool { return friend.Nickname == nickname })
 }
 
 func (f Friends) SearchByRemark(remark string, limit uint) Friends {
+	if index := f.indexed(); index != nil {
+		return f.searchIndex(index, index.byRemark[remark], limit)
+	}
 	return f.Search(limit, func(friend *Friend) bool { return friend.Remark == remark })
 }
 
@@ -172,11 +210,7 @@ func (g *Group) Members() ([]*Profile, error) {
 }
 
 func (g *Group) SendAtText(content string, memberIDs ...string) error {
-	return g.Owner().bot.client.SendAtText(g.Owner().bot.Context(), apiclient.SendAtTextOption{
-		GroupID: g.Wxid,
-		AtList:  memberIDs,
-		Content: content,
-	})
+	return g.Owner().sendAtText(g.Wxid, content, memberIDs)
 }
 
 func (g *Group) SendAtALLTextMsg(content string) error {
@@ -188,6 +222,21 @@ func (g *Group) AddMemberIntoChatRoom(friends ...*Friend) error {
 	return g.Owner().AddMemberIntoChatRoom(g, friends...)
 }
 
+// RemoveMembers 把成员移出群聊，需要是群主或者管理员
+// 不是群主或者管理员时返回 ErrNotGroupAdmin，成员不在群里时返回 ErrNotGroupMember
+func (g *Group) RemoveMembers(members ...Recipient) error {
+	memberIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		memberIDs = append(memberIDs, member.recipientID())
+	}
+	return g.Owner().DelMemberFromChatRoom(g, memberIDs...)
+}
+
+// SetMyDisplayName 修改自己的群昵称，已经不在群里时返回 ErrNotGroupMember
+func (g *Group) SetMyDisplayName(name string) error {
+	return g.Owner().ModifyNickname(g, name)
+}
+
 func (g *Group) Quit() error {
 	return g.Owner().QuitChatRoom(g)
 }
@@ -218,8 +267,31 @@ func (g Groups) Search(limit uint, searchFunc func(group *Group) bool) Groups {
 	return search
 }
 
+// indexed returns the index of the contact list if g is all the groups in it.
+func (g Groups) indexed() *contactIndex {
+	if len(g) == 0 {
+		return nil
+	}
+	index := g[0].index
+	if index == nil || index.groups != len(g) || g[len(g)-1].index != index {
+		return nil
+	}
+	return index
+}
+
+func (g Groups) searchIndex(index *contactIndex, users []*User, limit uint) Groups {
+	return index.search(users, g[0].owner, limit, (*User).IsGroup).Groups()
+}
+
 func (g Groups) SearchByWxID(wxID string) (*Group, bool) {
-	search := g.Search(1, func(group *Group) bool { return group.Wxid == wxID })
+	var search Groups
+	if index := g.indexed(); index != nil {
+		if user, ok := index.byWxID[wxID]; ok {
+			search = g.searchIndex(index, []*User{user}, 1)
+		}
+	} else {
+		search = g.Search(1, func(group *Group) bool { return group.Wxid == wxID })
+	}
 	if len(search) == 0 {
 		return nil, false
 	}
@@ -227,6 +299,9 @@ func (g Groups) SearchByWxID(wxID string) (*Group, bool) {
 }
 
 func (g Groups) SearchByNickname(nickname string, limit uint) Groups {
+	if index := g.indexed(); index != nil {
+		return g.searchIndex(index, index.byNickname[nickname], limit)
+	}
 	return g.Search(limit, func(group *Group) bool { return group.Nickname == nickname })
 }
 
@@ -281,4 +356,20 @@ type Profile struct {
 	Nickname  string `json:"nickname"`
 	V3        string `json:"v3"`
 	Wxid      string `json:"wxid"`
+	// DisplayName 是成员在群里的昵称，只有获取群成员时才有
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// Recipient 是消息或者操作的对象，*User、*Friend、*Group、*Profile 和 WxID 都实现了它
+type Recipient interface {
+	recipientID() string
 }
+
+// WxID 是用户或者群的 wxid
+type WxID string
+
+func (id WxID) recipientID() string { return string(id) }
+
+func (u *User) recipientID() string { return u.Wxid }
+
+func (p *Profile) recipientID() string { return p.Wxid }
@@ -0,0 +1,90 @@
+package wxhelper
+
+import (
+	"errors"
+	"github.com/eatmoreapple/wxhelper/apiclient"
+	"github.com/eatmoreapple/wxhelper/wxtest"
+	"testing"
+)
+
+func TestGroupModeration(t *testing.T) {
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot"})
+	stack.AddGroup("123@chatroom", "测试群",
+		&wxtest.Member{Wxid: "wxid_bot", Nickname: "bot"},
+		&wxtest.Member{Wxid: "wxid_a", Nickname: "Alice"},
+		&wxtest.Member{Wxid: "wxid_b", Nickname: "Bob"},
+	)
+	bot := New(stack.URL)
+	t.Cleanup(bot.Stop)
+	account, err := bot.GetLoginAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := account.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, ok := groups.SearchByWxID("123@chatroom")
+	if !ok {
+		t.Fatal("group not found")
+	}
+	// 不在群里的成员不会发给注入服务器
+	if err = group.RemoveMembers(WxID("wxid_a"), WxID("wxid_c")); !errors.Is(err, ErrNotGroupMember) {
+		t.Fatalf("expected %v, got %v", ErrNotGroupMember, err)
+	}
+	members, err := group.Members()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = group.RemoveMembers(members[1], &User{Wxid: "wxid_b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = group.SetMyDisplayName("机器人"); err != nil {
+		t.Fatal(err)
+	}
+	if members, err = group.Members(); err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].Wxid != "wxid_bot" || members[0].DisplayName != "机器人" {
+		t.Fatalf("unexpected members %+v", members)
+	}
+
+	// 注入服务器返回失败时返回错误
+	if err = group.Quit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = group.RemoveMembers(WxID("wxid_bot")); err == nil {
+		t.Fatal("expected error after quitting the group")
+	}
+
+	// 不是群主时不能移出成员
+	stack.AddGroup("456@chatroom", "别人的群",
+		&wxtest.Member{Wxid: "wxid_a", Nickname: "Alice"},
+		&wxtest.Member{Wxid: "wxid_bot", Nickname: "bot"},
+	)
+	bot.Contacts().Invalidate()
+	if groups, err = account.Groups(); err != nil {
+		t.Fatal(err)
+	}
+	other, ok := groups.SearchByWxID("456@chatroom")
+	if !ok {
+		t.Fatal("group not found")
+	}
+	if err = other.RemoveMembers(WxID("wxid_a")); !errors.Is(err, ErrNotGroupAdmin) {
+		t.Fatalf("expected %v, got %v", ErrNotGroupAdmin, err)
+	}
+	if len(stack.GroupMembers("456@chatroom")) != 2 {
+		t.Fatal("expected the members not to be removed")
+	}
+	// 退群之后不能修改群昵称
+	if err = group.SetMyDisplayName("机器人"); !errors.Is(err, ErrNotGroupMember) {
+		t.Fatalf("expected %v, got %v", ErrNotGroupMember, err)
+	}
+	// 未知的错误码不当作权限错误
+	stack.Fail("/api/delMemberFromChatRoom")
+	err = other.RemoveMembers(WxID("wxid_a"))
+	var resultErr *apiclient.ResultError
+	if !errors.As(err, &resultErr) || errors.Is(err, ErrNotGroupAdmin) {
+		t.Fatalf("expected a result error, got %v", err)
+	}
+}
@@ -0,0 +1,621 @@
+// Package wxtest 提供了注入服务器的本地实现，用于在测试中运行完整的 Bot。
+package wxtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eatmoreapple/wxhelper/internal/models"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Account 是登录的微信账号
+	Account = models.Account
+	// Contact 是联系人，包括好友和群
+	Contact = models.User
+	// Member 是群成员，DisplayName 是成员的群昵称
+	Member = models.Profile
+	// Message 是注入服务器推送的消息
+	Message = models.Message
+)
+
+// ErrNotHooked 表示 APIServer 还没有注册消息回调
+var ErrNotHooked = errors.New("sync message is not hooked")
+
+// 群管理接口失败时的错误码，和注入服务器一致
+const (
+	chatRoomCodeNotAdmin  = -2
+	chatRoomCodeNotMember = -3
+)
+
+// SentKind 是发送消息的类型
+type SentKind string
+
+const (
+	SentText    SentKind = "text"
+	SentImage   SentKind = "image"
+	SentFile    SentKind = "file"
+	SentAtText  SentKind = "atText"
+	SentForward SentKind = "forward"
+	SentApp     SentKind = "app"
+)
+
+// Sent 是通过注入服务器发送的消息
+type Sent struct {
+	Kind    SentKind
+	To      string
+	Content string
+	AtList  []string
+	// Path 是图片和文件在注入服务器上的路径
+	Path string
+	// MsgID 是转发的消息的 id
+	MsgID string
+	Time  time.Time
+}
+
+type media struct {
+	kind string
+	chat string
+	name string
+	data []byte
+}
+
+type group struct {
+	info    models.ChatRoomInfo
+	members []*Member
+}
+
+// InjectServer 模拟注入服务器的 http 接口，联系人、群成员可以在测试中随时修改。
+// 发送的消息会被记录下来，通过 Inject 可以像微信一样推送消息给 APIServer。
+type InjectServer struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	loggedIn bool
+	account  Account
+	contacts []*Contact
+	groups   map[string]*group
+	hookAddr string
+	sent     []Sent
+	sentCond chan struct{}
+	msgID    int64
+	dataDir  string
+	media    map[int64]*media
+	// unsupported 中的接口返回 404
+	unsupported map[string]bool
+	// failing 中的接口返回失败的 code
+	failing map[string]bool
+}
+
+// URL returns the base url of the server.
+func (s *InjectServer) URL() string {
+	return s.server.URL
+}
+
+// Close shuts down the server and removes the data dir.
+func (s *InjectServer) Close() {
+	s.server.Close()
+	_ = os.RemoveAll(s.dataDir)
+}
+
+// DataDir returns the local dir of the CurrentDataPath of the account,
+// the voices, videos and files are downloaded into it.
+func (s *InjectServer) DataDir() string {
+	return s.dataDir
+}
+
+// Login marks the account as logged in.
+// The CurrentDataPath of the account is set to a windows path if it is empty.
+func (s *InjectServer) Login(account Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if account.CurrentDataPath == "" {
+		account.CurrentDataPath = `C:\WeChat Files\` + account.Wxid + `\`
+	}
+	s.account = account
+	s.loggedIn = true
+}
+
+// Logout marks the account as logged out.
+func (s *InjectServer) Logout() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loggedIn = false
+}
+
+// AddContacts adds or replaces the contacts.
+func (s *InjectServer) AddContacts(contacts ...*Contact) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, contact := range contacts {
+		s.removeContact(contact.Wxid)
+		s.contacts = append(s.contacts, contact)
+	}
+}
+
+// AddFriend adds a friend with the nickname.
+func (s *InjectServer) AddFriend(wxID, nickname string) {
+	s.AddContacts(&Contact{Wxid: wxID, Nickname: nickname, Type: 3})
+}
+
+// RemoveContact removes the contact.
+func (s *InjectServer) RemoveContact(wxID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeContact(wxID)
+}
+
+func (s *InjectServer) removeContact(wxID string) {
+	for i, contact := range s.contacts {
+		if contact.Wxid == wxID {
+			s.contacts = append(s.contacts[:i], s.contacts[i+1:]...)
+			return
+		}
+	}
+}
+
+// AddGroup adds or replaces the group with the members, the first member is the admin.
+func (s *InjectServer) AddGroup(groupID, nickname string, members ...*Member) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeContact(groupID)
+	s.contacts = append(s.contacts, &Contact{Wxid: groupID, Nickname: nickname, Type: 2})
+	g := &group{info: models.ChatRoomInfo{ChatRoomID: groupID}, members: members}
+	if len(members) > 0 {
+		g.info.Admin = members[0].Wxid
+	}
+	s.groups[groupID] = g
+}
+
+// SetGroupMembers replaces the members of the group.
+func (s *InjectServer) SetGroupMembers(groupID string, members ...*Member) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g, ok := s.groups[groupID]; ok {
+		g.members = members
+	}
+}
+
+// GroupMembers returns the members of the group.
+func (s *InjectServer) GroupMembers(groupID string) []*Member {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.groups[groupID]
+	if !ok {
+		return nil
+	}
+	members := make([]*Member, len(g.members))
+	for i, member := range g.members {
+		copied := *member
+		members[i] = &copied
+	}
+	return members
+}
+
+// AddVoice adds the voice of the message, it is saved by getVoiceByMsgId.
+func (s *InjectServer) AddVoice(msgID int64, data []byte) {
+	s.addMedia(msgID, &media{kind: "voice", data: data})
+}
+
+// AddVideo adds the video of the message from the chat, it is saved by downloadAttach.
+func (s *InjectServer) AddVideo(msgID int64, chat string, data []byte) {
+	s.addMedia(msgID, &media{kind: "video", chat: chat, name: strconv.FormatInt(msgID, 10) + ".mp4", data: data})
+}
+
+// AddFile adds the file attachment of the message from the chat, it is saved by downloadAttach.
+func (s *InjectServer) AddFile(msgID int64, chat, filename string, data []byte) {
+	s.addMedia(msgID, &media{kind: "file", chat: chat, name: filename, data: data})
+}
+
+func (s *InjectServer) addMedia(msgID int64, m *media) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.media[msgID] = m
+}
+
+// localPath converts the windows path under the CurrentDataPath to the path under the data dir.
+func (s *InjectServer) localPath(path string) (string, bool) {
+	rel, ok := strings.CutPrefix(path, strings.TrimRight(s.account.CurrentDataPath, `\`))
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(s.dataDir, filepath.FromSlash(strings.ReplaceAll(rel, `\`, "/"))), true
+}
+
+func writeMedia(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Unsupported makes the apis of the paths respond 404, like an older inject server.
+func (s *InjectServer) Unsupported(paths ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, path := range paths {
+		s.unsupported[path] = true
+	}
+}
+
+// Fail makes the apis of the paths respond the code 0, like the inject server failed to handle them.
+func (s *InjectServer) Fail(paths ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, path := range paths {
+		s.failing[path] = true
+	}
+}
+
+// Sent returns the messages sent so far.
+func (s *InjectServer) Sent() []Sent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Sent(nil), s.sent...)
+}
+
+// WaitSent waits until at least n messages are sent and returns them.
+func (s *InjectServer) WaitSent(ctx context.Context, n int) ([]Sent, error) {
+	for {
+		s.mu.Lock()
+		if len(s.sent) >= n {
+			sent := append([]Sent(nil), s.sent...)
+			s.mu.Unlock()
+			return sent, nil
+		}
+		cond := s.sentCond
+		s.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-cond:
+		}
+	}
+}
+
+// appendSent records the message and wakes up the waiters, must be called with the lock held.
+func (s *InjectServer) appendSent(sent Sent) {
+	sent.Time = time.Now()
+	s.sent = append(s.sent, sent)
+	close(s.sentCond)
+	s.sentCond = make(chan struct{})
+}
+
+// HookAddr returns the address of the message listener registered by the APIServer.
+func (s *InjectServer) HookAddr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hookAddr
+}
+
+// Inject pushes the message to the APIServer through the hooked TCP listener.
+// The MsgId and CreateTime are filled if they are zero.
+func (s *InjectServer) Inject(msg *Message) error {
+	s.mu.Lock()
+	addr := s.hookAddr
+	if msg.MsgId == 0 {
+		s.msgID++
+		msg.MsgId = s.msgID
+	}
+	if msg.CreateTime == 0 {
+		msg.CreateTime = int(time.Now().Unix())
+	}
+	s.mu.Unlock()
+	if addr == "" {
+		return ErrNotHooked
+	}
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	if err = json.NewEncoder(conn).Encode(msg); err != nil {
+		return err
+	}
+	// 等待 APIServer 处理完消息
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return err
+	}
+	if string(reply) != "200 OK" {
+		return fmt.Errorf("unexpected reply %q", reply)
+	}
+	return nil
+}
+
+// InjectText pushes a text message from the friend.
+func (s *InjectServer) InjectText(from, content string) error {
+	return s.Inject(&Message{Type: 1, FromUser: from, ToUser: s.accountID(), Content: content})
+}
+
+// InjectGroupText pushes a text message sent by the member to the group.
+func (s *InjectServer) InjectGroupText(groupID, senderID, content string) error {
+	return s.Inject(&Message{
+		Type:     1,
+		FromUser: groupID,
+		ToUser:   s.accountID(),
+		Content:  senderID + ":\n" + content,
+	})
+}
+
+func (s *InjectServer) accountID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.account.Wxid
+}
+
+type result struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data any    `json:"data,omitempty"`
+}
+
+func writeResult(w http.ResponseWriter, code int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result{Code: code, Data: data})
+}
+
+func (s *InjectServer) handle(mux *http.ServeMux, path string, handler func(body map[string]any) (int, any)) {
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		unsupported := s.unsupported[path]
+		s.mu.Unlock()
+		if unsupported {
+			http.NotFound(w, r)
+			return
+		}
+		body := make(map[string]any)
+		if r.ContentLength != 0 {
+			decoder := json.NewDecoder(r.Body)
+			decoder.UseNumber()
+			if err := decoder.Decode(&body); err != nil && err != io.EOF {
+				writeResult(w, -1, nil)
+				return
+			}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.failing[path] {
+			writeResult(w, 0, nil)
+			return
+		}
+		code, data := handler(body)
+		writeResult(w, code, data)
+	})
+}
+
+func (s *InjectServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	s.handle(mux, "/api/checkLogin", func(map[string]any) (int, any) {
+		if s.loggedIn {
+			return 1, nil
+		}
+		return 0, nil
+	})
+	s.handle(mux, "/api/userInfo", func(map[string]any) (int, any) {
+		if !s.loggedIn {
+			return 0, nil
+		}
+		account := s.account
+		return 1, &account
+	})
+	s.handle(mux, "/api/getContactList", func(map[string]any) (int, any) {
+		return 1, s.contacts
+	})
+	s.handle(mux, "/api/hookSyncMsg", func(body map[string]any) (int, any) {
+		s.hookAddr = net.JoinHostPort(str(body["ip"]), str(body["port"]))
+		return 0, nil
+	})
+	s.handle(mux, "/api/unhookSyncMsg", func(map[string]any) (int, any) {
+		s.hookAddr = ""
+		return 0, nil
+	})
+	s.handle(mux, "/api/sendTextMsg", s.sendHandler(func(body map[string]any) Sent {
+		return Sent{Kind: SentText, To: str(body["wxid"]), Content: str(body["msg"])}
+	}))
+	s.handle(mux, "/api/sendImagesMsg", s.sendHandler(func(body map[string]any) Sent {
+		return Sent{Kind: SentImage, To: str(body["wxid"]), Path: str(body["imagePath"])}
+	}))
+	s.handle(mux, "/api/sendFileMsg", s.sendHandler(func(body map[string]any) Sent {
+		return Sent{Kind: SentFile, To: str(body["wxid"]), Path: str(body["filePath"])}
+	}))
+	s.handle(mux, "/api/sendAtText", s.sendHandler(func(body map[string]any) Sent {
+		sent := Sent{Kind: SentAtText, To: str(body["chatRoomId"]), Content: str(body["msg"])}
+		if wxIDs := str(body["wxids"]); wxIDs != "" {
+			sent.AtList = strings.Split(wxIDs, ",")
+		}
+		return sent
+	}))
+	s.handle(mux, "/api/forwardMsg", s.sendHandler(func(body map[string]any) Sent {
+		return Sent{Kind: SentForward, To: str(body["wxid"]), MsgID: str(body["msgId"])}
+	}))
+	s.handle(mux, "/api/forwardMessage", s.sendHandler(func(body map[string]any) Sent {
+		return Sent{Kind: SentForward, To: str(body["wxid"]), MsgID: str(body["msgid"])}
+	}))
+	s.handle(mux, "/api/sendAppMsg", s.sendHandler(func(body map[string]any) Sent {
+		return Sent{Kind: SentApp, To: str(body["wxid"]), Content: str(body["xml"])}
+	}))
+	s.handle(mux, "/api/getChatRoomDetailInfo", func(body map[string]any) (int, any) {
+		g, ok := s.groups[str(body["chatRoomId"])]
+		if !ok {
+			return 0, nil
+		}
+		return 1, g.info
+	})
+	s.handle(mux, "/api/getMemberFromChatRoom", func(body map[string]any) (int, any) {
+		g, ok := s.groups[str(body["chatRoomId"])]
+		if !ok {
+			return 0, nil
+		}
+		ids := make([]string, len(g.members))
+		names := make([]string, len(g.members))
+		for i, member := range g.members {
+			ids[i] = member.Wxid
+			names[i] = member.DisplayName
+		}
+		return 1, models.GroupMember{
+			ChatRoomID:     g.info.ChatRoomID,
+			Members:        strings.Join(ids, "^G"),
+			MemberNickname: strings.Join(names, "^G"),
+			Admin:          g.info.Admin,
+		}
+	})
+	s.handle(mux, "/api/getContactProfile", func(body map[string]any) (int, any) {
+		wxID := str(body["wxid"])
+		for _, g := range s.groups {
+			for _, member := range g.members {
+				if member.Wxid == wxID {
+					return 1, models.Profile{Wxid: member.Wxid, Account: member.Account, Nickname: member.Nickname, HeadImage: member.HeadImage, V3: member.V3}
+				}
+			}
+		}
+		for _, contact := range s.contacts {
+			if contact.Wxid == wxID {
+				return 1, models.Profile{Wxid: contact.Wxid, Account: contact.CustomAccount, Nickname: contact.Nickname}
+			}
+		}
+		return 1, models.Profile{Wxid: wxID}
+	})
+	s.handle(mux, "/api/addMemberToChatRoom", s.addMembers)
+	s.handle(mux, "/api/InviteMemberToChatRoom", s.addMembers)
+	s.handle(mux, "/api/delMemberFromChatRoom", func(body map[string]any) (int, any) {
+		g, ok := s.groups[str(body["chatRoomId"])]
+		if !ok {
+			return chatRoomCodeNotMember, nil
+		}
+		// 只有群主可以移出成员
+		if g.info.Admin != s.account.Wxid {
+			return chatRoomCodeNotAdmin, nil
+		}
+		removed := make(map[string]bool)
+		if ids, ok := body["memberIds"].([]any); ok {
+			for _, id := range ids {
+				removed[str(id)] = true
+			}
+		}
+		members := g.members[:0]
+		for _, member := range g.members {
+			if !removed[member.Wxid] {
+				members = append(members, member)
+			}
+		}
+		g.members = members
+		return 1, nil
+	})
+	s.handle(mux, "/api/modifyNickname", func(body map[string]any) (int, any) {
+		g, ok := s.groups[str(body["chatRoomId"])]
+		if !ok {
+			return chatRoomCodeNotMember, nil
+		}
+		for _, member := range g.members {
+			if member.Wxid == str(body["wxid"]) {
+				member.DisplayName = str(body["nickName"])
+				return 1, nil
+			}
+		}
+		return chatRoomCodeNotMember, nil
+	})
+	s.handle(mux, "/api/getVoiceByMsgId", func(body map[string]any) (int, any) {
+		msgID, _ := strconv.ParseInt(str(body["msgId"]), 10, 64)
+		m, ok := s.media[msgID]
+		if !ok || m.kind != "voice" {
+			return -1, nil
+		}
+		dir, ok := s.localPath(str(body["storeDir"]))
+		if !ok {
+			return -1, nil
+		}
+		if err := writeMedia(filepath.Join(dir, strconv.FormatInt(msgID, 10)+".amr"), m.data); err != nil {
+			return -1, nil
+		}
+		return 1, nil
+	})
+	s.handle(mux, "/api/downloadAttach", func(body map[string]any) (int, any) {
+		msgID, _ := strconv.ParseInt(str(body["msgId"]), 10, 64)
+		m, ok := s.media[msgID]
+		if !ok || m.kind == "voice" {
+			return -1, nil
+		}
+		path := filepath.Join(s.dataDir, "wxhelper", m.kind, m.chat, m.name)
+		if err := writeMedia(path, m.data); err != nil {
+			return -1, nil
+		}
+		return 0, nil
+	})
+	s.handle(mux, "/api/quitChatRoom", func(body map[string]any) (int, any) {
+		groupID := str(body["chatRoomId"])
+		if _, ok := s.groups[groupID]; !ok {
+			return 0, nil
+		}
+		delete(s.groups, groupID)
+		s.removeContact(groupID)
+		return 1, nil
+	})
+	return mux
+}
+
+func (s *InjectServer) sendHandler(parse func(body map[string]any) Sent) func(map[string]any) (int, any) {
+	return func(body map[string]any) (int, any) {
+		s.appendSent(parse(body))
+		return 1, nil
+	}
+}
+
+func (s *InjectServer) addMembers(body map[string]any) (int, any) {
+	g, ok := s.groups[str(body["chatRoomId"])]
+	if !ok {
+		return 0, nil
+	}
+	for _, id := range strings.Split(str(body["memberIds"]), ",") {
+		if id == "" {
+			continue
+		}
+		member := &Member{Wxid: id}
+		for _, contact := range s.contacts {
+			if contact.Wxid == id {
+				member.Nickname = contact.Nickname
+			}
+		}
+		g.members = append(g.members, member)
+	}
+	return 1, nil
+}
+
+func str(v any) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// NewInjectServer starts a fake inject server without any account logged in.
+func NewInjectServer() *InjectServer {
+	dataDir, err := os.MkdirTemp("", "wxtest")
+	if err != nil {
+		panic(err)
+	}
+	s := &InjectServer{
+		groups:      make(map[string]*group),
+		sentCond:    make(chan struct{}),
+		dataDir:     dataDir,
+		media:       make(map[int64]*media),
+		unsupported: make(map[string]bool),
+		failing:     make(map[string]bool),
+	}
+	s.server = httptest.NewServer(s.routes())
+	return s
+}
@@ -0,0 +1,78 @@
+package wxtest
+
+import (
+	"context"
+	"errors"
+	"github.com/eatmoreapple/wxhelper/apiserver"
+	"github.com/eatmoreapple/wxhelper/pkg/dedup"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Stack 是完全在本地运行的注入服务器和 APIServer，Bot 可以直接连接 URL。
+type Stack struct {
+	*InjectServer
+	APIServer *apiserver.APIServer
+	// URL 是 APIServer 的地址
+	URL string
+
+	server *httptest.Server
+	cancel context.CancelFunc
+}
+
+// Close stops the APIServer and the inject server.
+func (s *Stack) Close() {
+	s.cancel()
+	s.server.Close()
+	s.InjectServer.Close()
+}
+
+// StartStack starts an APIServer in front of a fake inject server with the account logged in,
+// and waits until the APIServer notices the login.
+func StartStack(account Account) (*Stack, error) {
+	inject := NewInjectServer()
+	inject.Login(account)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := apiserver.NewWithInjectServer(inject.URL())
+	srv.Context = ctx
+	srv.MessageListenerAddr = "127.0.0.1:0"
+	srv.MediaDir = inject.DataDir()
+	// 和 apiserver.Default 一样过滤注入服务器重复推送的消息
+	srv.Deduplicator = dedup.New(dedup.NewMemoryStore(10000, 24*time.Hour))
+	handler, err := srv.Start()
+	if err != nil {
+		cancel()
+		inject.Close()
+		return nil, err
+	}
+	stack := &Stack{
+		InjectServer: inject,
+		APIServer:    srv,
+		server:       httptest.NewServer(handler),
+		cancel:       cancel,
+	}
+	stack.URL = stack.server.URL
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !srv.IsLogin() {
+		if time.Now().After(deadline) {
+			stack.Close()
+			return nil, errors.New("apiserver did not log in")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return stack, nil
+}
+
+// NewStack starts a Stack for the test and closes it when the test finishes.
+func NewStack(t testing.TB, account Account) *Stack {
+	t.Helper()
+	stack, err := StartStack(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(stack.Close)
+	return stack
+}
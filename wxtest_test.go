@@ -0,0 +1,121 @@
+package wxhelper
+
+import (
+	"context"
+	"github.com/eatmoreapple/wxhelper/pkg/dedup"
+	"github.com/eatmoreapple/wxhelper/wxtest"
+	"testing"
+	"time"
+)
+
+func TestBotWithLocalStack(t *testing.T) {
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot", Name: "bot"})
+	stack.AddFriend("wxid_a", "Alice")
+	stack.AddGroup("123@chatroom", "测试群",
+		&wxtest.Member{Wxid: "wxid_a", Nickname: "Alice", DisplayName: "小A"},
+		&wxtest.Member{Wxid: "wxid_bot", Nickname: "bot"},
+	)
+
+	bot := New(stack.URL)
+	bot.MessageHandler = func(msg *Message) {
+		switch msg.Text() {
+		case "ping":
+			_ = msg.ReplyText("pong")
+		case "members":
+			_ = msg.ReplyMention("收到")
+		}
+	}
+	t.Cleanup(bot.Stop)
+	go func() { _ = bot.Run() }()
+
+	account, err := bot.GetLoginAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	friends, err := account.Friends()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(friends) != 1 || friends[0].Wxid != "wxid_a" {
+		t.Fatalf("unexpected friends %v", friends)
+	}
+
+	if err = stack.InjectText("wxid_a", "ping"); err != nil {
+		t.Fatal(err)
+	}
+	// 群消息 @ 发送者时使用群昵称
+	if err = stack.InjectGroupText("123@chatroom", "wxid_a", "members"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sent, err := stack.WaitSent(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range sent {
+		switch s.To {
+		case "wxid_a":
+			if s.Kind != wxtest.SentText || s.Content != "pong" {
+				t.Fatalf("unexpected reply %+v", s)
+			}
+		case "123@chatroom":
+			if s.Kind != wxtest.SentAtText || s.Content != "@小A\u2005收到" || len(s.AtList) != 1 || s.AtList[0] != "wxid_a" {
+				t.Fatalf("unexpected reply %+v", s)
+			}
+		default:
+			t.Fatalf("unexpected reply %+v", s)
+		}
+	}
+}
+
+func TestDeduplicateMessages(t *testing.T) {
+	stack := wxtest.NewStack(t, wxtest.Account{Wxid: "wxid_bot", Account: "bot"})
+	handled := make(chan string, 4)
+	bot := New(stack.URL)
+	bot.MessageHandler = func(msg *Message) { handled <- msg.Content }
+	t.Cleanup(bot.Stop)
+	go func() { _ = bot.Run() }()
+
+	// 注入服务器重复推送同一条消息
+	for _, content := range []string{"first", "first", "second"} {
+		msgID := int64(1)
+		if content == "second" {
+			msgID = 2
+		}
+		if err := stack.Inject(&wxtest.Message{Type: 1, MsgId: msgID, FromUser: "wxid_a", ToUser: "wxid_bot", Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, expected := range []string{"first", "second"} {
+		select {
+		case content := <-handled:
+			if content != expected {
+				t.Fatalf("expected %s, got %s", expected, content)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the message is not handled")
+		}
+	}
+	if suppressed := stack.APIServer.Deduplicator.Suppressed(); suppressed != 1 {
+		t.Fatalf("expected 1 suppressed message, got %d", suppressed)
+	}
+
+	// APIServer 重启后重新投递的消息由 Bot 过滤
+	now := time.Now()
+	replayer := NewReplayer([]*RecordedMessage{
+		{Time: now, Message: &Message{Type: 1, MsgId: 1, FromUser: "wxid_a", ToUser: "wxid_bot", Content: "ping"}},
+		{Time: now, Message: &Message{Type: 1, MsgId: 1, FromUser: "wxid_a", ToUser: "wxid_bot", Content: "ping"}},
+	})
+	deduplicator := dedup.New(dedup.NewMemoryStore(100, 0))
+	sent, err := replayer.Replay(func(bot *Bot) {
+		bot.Deduplicator = deduplicator
+		bot.MessageHandler = func(msg *Message) { _ = msg.ReplyText("pong") }
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || deduplicator.Suppressed() != 1 {
+		t.Fatalf("expected 1 reply and 1 suppressed message, got %d and %d", len(sent), deduplicator.Suppressed())
+	}
+}